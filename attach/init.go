@@ -1,13 +1,17 @@
 package attach
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"os"
 	"reflect"
 	"runtime"
+	"strconv"
 	"time"
 
 	"loov.dev/allocview/internal/packet"
+	"loov.dev/allocview/internal/protocol"
 )
 
 // Addr returns the address of this func.
@@ -19,45 +23,138 @@ func Addr() (string, uintptr) {
 }
 
 func init() {
-	sockPath := os.Getenv("ALLOCLOGSOCK")
-	if sockPath == "" {
+	network, address := "unix", os.Getenv("ALLOCLOGSOCK")
+	if addr := os.Getenv("ALLOCLOGADDR"); addr != "" {
+		network, address = protocol.ParseAddr(addr)
+	}
+	if address == "" {
 		return
 	}
 
 	exe, err := os.Executable()
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "allocview: failed to find the executable, not monitoring: %v\n", err)
+		return
+	}
+
+	rate := 1
+	if v := os.Getenv("ALLOCLOGRATE"); v != "" {
+		rate, err = strconv.Atoi(v)
+		if err != nil || rate <= 0 {
+			fmt.Fprintf(os.Stderr, "allocview: invalid ALLOCLOGRATE %q, not monitoring\n", v)
+			return
+		}
 	}
+	interval := time.Second / 10
+	if v := os.Getenv("ALLOCLOGINTERVAL"); v != "" {
+		interval, err = time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			fmt.Fprintf(os.Stderr, "allocview: invalid ALLOCLOGINTERVAL %q, not monitoring\n", v)
+			return
+		}
+	}
+
+	forceGC := os.Getenv("ALLOCLOGFORCEGC") == "1"
 
-	sockAddr, err := net.ResolveUnixAddr("unix", sockPath)
+	conn, err := net.Dial(network, address)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "allocview: failed to connect to %s, not monitoring: %v\n", address, err)
+		return
 	}
 
-	conn, err := net.DialUnix("unix", nil, sockAddr)
+	err = monitor(exe, conn, rate, interval, forceGC)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "allocview: not monitoring: %v\n", err)
+		return
 	}
 
-	runtime.MemProfileRate = 1
+	// profiling every allocation is slow, so it's only
+	// enabled when there's a viewer
+	runtime.MemProfileRate = rate
+}
 
-	err = monitor(exe, conn)
-	if err != nil {
-		panic(err)
+// readReply reads the reply of the viewer to the hello packet
+// and returns the enabled features.
+//
+// When the viewer rejects the connection, the error contains its message.
+func readReply(conn net.Conn) (protocol.Features, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return 0, err
 	}
+
+	dec := packet.Decoder{MaxSize: protocol.MaxHandshakeSize}
+	if err := dec.Read(conn); err != nil {
+		return 0, fmt.Errorf("failed to read reply from viewer: %w", err)
+	}
+
+	magic := dec.String()
+	version := dec.Uint32()
+	features := protocol.Features(dec.Uint32())
+	message := dec.String()
+	switch {
+	case dec.Err() != nil || magic != protocol.ViewerMagic:
+		return 0, errors.New("invalid reply from viewer")
+	case message != "":
+		return 0, errors.New("viewer rejected the connection: " + message)
+	case version != protocol.Version:
+		return 0, fmt.Errorf("viewer uses protocol version %d, expected %d", version, protocol.Version)
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return 0, err
+	}
+	return features & protocol.Supported, nil
 }
 
-func monitor(exe string, conn *net.UnixConn) error {
+// encodeGCs encodes the GC cycles completed after cycle lastGC.
+//
+// The completion times are sent relative to now, which avoids issues
+// with clocks that differ between the machines.
+func encodeGCs(enc *packet.Encoder, now time.Time, stats *runtime.MemStats, lastGC uint32) {
+	from := lastGC + 1
+	if n := uint32(len(stats.PauseEnd)); stats.NumGC >= n && from <= stats.NumGC-n {
+		from = stats.NumGC - n + 1
+	}
+	if from > stats.NumGC {
+		enc.Uint32(0)
+		return
+	}
+
+	enc.Uint32(stats.NumGC - from + 1)
+	for cycle := from; cycle <= stats.NumGC; cycle++ {
+		i := (cycle + uint32(len(stats.PauseEnd)) - 1) % uint32(len(stats.PauseEnd))
+		enc.Uint32(cycle)
+		enc.Int64(now.UnixNano() - int64(stats.PauseEnd[i]))
+		enc.Uint64(stats.PauseNs[i])
+	}
+}
+
+// monitor sends the memory profile to conn every interval.
+//
+// The runtime updates the memory profile at the end of a GC cycle, so
+// the profile is only sent after a new cycle, unless forceGC is set, which
+// runs a GC before each profile.
+func monitor(exe string, conn net.Conn, rate int, interval time.Duration, forceGC bool) error {
 	enc := packet.NewEncoder(1 << 20)
 
-	enc.String("alloclog")
+	enc.String(protocol.AgentMagic)
+	enc.Uint32(protocol.Version)
+	enc.Uint32(uint32(protocol.Supported))
 	enc.String(exe)
 
 	name, addr := Addr()
 	enc.String(name)
 	enc.Uintptr(addr)
+	enc.Uint32(uint32(os.Getpid()))
+	enc.Uint32(uint32(rate))
 
 	if _, err := conn.Write(enc.LengthAndBytes()); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	features, err := readReply(conn)
+	if err != nil {
 		_ = conn.Close()
 		return err
 	}
@@ -65,41 +162,53 @@ func monitor(exe string, conn *net.UnixConn) error {
 	go func() {
 		defer conn.Close()
 
-		tick := time.NewTicker(time.Second / 10)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
 		records := make([]runtime.MemProfileRecord, 1000)
+		state := protocol.NewRecordEncoder(rate)
+
+		var stats runtime.MemStats
+		samples := newMetricSamples()
+		sent, lastGC := false, uint32(0)
 		for t := range tick.C {
-			// TODO: figure out a better way to do this
-			// runtime.GC forces mem profile to be updated
-			runtime.GC()
-		tryagain:
-			n, ok := runtime.MemProfile(records, true)
-			if !ok {
-				records = make([]runtime.MemProfileRecord, n+n/3)
-				goto tryagain
+			if forceGC {
+				runtime.GC()
 			}
+			numGC := readNumGC(&stats)
+
+			n := 0
+			// the profile and most of MemStats don't change without a GC
+			// cycle, ReadMemStats is avoided, because it stops the world
+			if !sent || numGC != lastGC {
+				runtime.ReadMemStats(&stats)
+			tryagain:
+				var ok bool
+				n, ok = runtime.MemProfile(records, true)
+				if !ok {
+					records = make([]runtime.MemProfileRecord, n+n/3)
+					goto tryagain
+				}
+			}
+
 			enc.Reset()
 
 			enc.Int64(t.UnixNano())
+			enc.Uint32(stats.NumGC)
 
-			enc.Uint32(uint32(n))
-		nextRecord:
-			for _, rec := range records[:n] {
-				enc.Int64(rec.AllocBytes)
-				enc.Int64(rec.FreeBytes)
-				enc.Int64(rec.AllocObjects)
-				enc.Int64(rec.FreeObjects)
-
-				for _, frame := range rec.Stack0 {
-					enc.Uintptr(frame)
-					if frame == 0 {
-						continue nextRecord
-					}
-				}
-				enc.Uintptr(0)
+			state.Encode(&enc, records[:n])
+
+			if features.Has(protocol.FeatureMetrics) {
+				encodeMetrics(&enc, samples, &stats)
 			}
+			if features.Has(protocol.FeatureGCs) {
+				encodeGCs(&enc, t, &stats, lastGC)
+			}
+
+			sent, lastGC = true, stats.NumGC
 
 			if _, err := conn.Write(enc.LengthAndBytes()); err != nil {
-				panic(err)
+				fmt.Fprintf(os.Stderr, "allocview: failed to send profile, stopped monitoring: %v\n", err)
+				return
 			}
 		}
 	}()
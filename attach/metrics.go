@@ -0,0 +1,75 @@
+//go:build go1.16
+// +build go1.16
+
+package attach
+
+import (
+	"runtime"
+	"runtime/metrics"
+
+	"loov.dev/allocview/internal/packet"
+)
+
+// metricNames are the runtime/metrics sent with each profile,
+// metrics that are not supported by the runtime are skipped.
+var metricNames = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/gc/heap/goal:bytes",
+	"/gc/heap/objects:objects",
+	"/gc/cycles/total:gc-cycles",
+	"/sched/goroutines:goroutines",
+	"/cpu/classes/gc/total:cpu-seconds",
+}
+
+// readNumGC returns the number of completed GC cycles,
+// without stopping the world like runtime.ReadMemStats.
+func readNumGC(stats *runtime.MemStats) uint32 {
+	sample := []metrics.Sample{{Name: "/gc/cycles/total:gc-cycles"}}
+	metrics.Read(sample)
+	return uint32(sample[0].Value.Uint64())
+}
+
+// metricSamples contains the samples for reading runtime/metrics.
+type metricSamples []metrics.Sample
+
+// newMetricSamples returns samples for the supported metricNames.
+func newMetricSamples() metricSamples {
+	supported := map[string]bool{}
+	for _, desc := range metrics.All() {
+		if desc.Kind == metrics.KindUint64 || desc.Kind == metrics.KindFloat64 {
+			supported[desc.Name] = true
+		}
+	}
+
+	var samples []metrics.Sample
+	for _, name := range metricNames {
+		if supported[name] {
+			samples = append(samples, metrics.Sample{Name: name})
+		}
+	}
+	return samples
+}
+
+// encodeMetrics reads and encodes the metrics and the MemStats section,
+// stats is only updated after GC cycles.
+func encodeMetrics(enc *packet.Encoder, samples metricSamples, stats *runtime.MemStats) {
+	metrics.Read(samples)
+
+	enc.Uint32(uint32(len(samples)))
+	for _, sample := range samples {
+		enc.String(sample.Name)
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			enc.Float64(float64(sample.Value.Uint64()))
+		case metrics.KindFloat64:
+			enc.Float64(sample.Value.Float64())
+		default:
+			enc.Float64(0)
+		}
+	}
+
+	enc.Uint64(stats.HeapInuse)
+	enc.Uint64(stats.NextGC)
+	enc.Uint64(stats.PauseTotalNs)
+	enc.Float64(stats.GCCPUFraction)
+}
@@ -0,0 +1,31 @@
+//go:build !go1.16
+// +build !go1.16
+
+package attach
+
+import (
+	"runtime"
+
+	"loov.dev/allocview/internal/packet"
+)
+
+// readNumGC reads stats and returns the number of completed GC cycles.
+func readNumGC(stats *runtime.MemStats) uint32 {
+	runtime.ReadMemStats(stats)
+	return stats.NumGC
+}
+
+// metricSamples is empty, because runtime/metrics is not available.
+type metricSamples struct{}
+
+func newMetricSamples() metricSamples { return metricSamples{} }
+
+// encodeMetrics encodes an empty metrics section and the MemStats section.
+func encodeMetrics(enc *packet.Encoder, samples metricSamples, stats *runtime.MemStats) {
+	enc.Uint32(0)
+
+	enc.Uint64(stats.HeapInuse)
+	enc.Uint64(stats.NextGC)
+	enc.Uint64(stats.PauseTotalNs)
+	enc.Float64(stats.GCCPUFraction)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CaptionMode defines how stack frames are displayed.
+type CaptionMode int
+
+const (
+	// CaptionFunc displays the function name with a shortened file path.
+	CaptionFunc CaptionMode = iota
+	// CaptionFile displays a shortened file path.
+	CaptionFile
+	// CaptionPath displays the full file path.
+	CaptionPath
+
+	captionModeCount
+)
+
+func (mode CaptionMode) String() string {
+	switch mode {
+	case CaptionFunc:
+		return "func"
+	case CaptionFile:
+		return "file"
+	case CaptionPath:
+		return "path"
+	default:
+		return "invalid"
+	}
+}
+
+// Set implements flag.Value.
+func (mode *CaptionMode) Set(value string) error {
+	for m := CaptionMode(0); m < captionModeCount; m++ {
+		if m.String() == value {
+			*mode = m
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown caption mode %q, expected func, file or path", value)
+}
+
+// Next returns the next mode for cycling.
+func (mode CaptionMode) Next() CaptionMode {
+	return (mode + 1) % captionModeCount
+}
+
+// FormatFrame formats a symbolized frame according to the mode.
+func (mode CaptionMode) FormatFrame(funcname, file string, line int) string {
+	switch mode {
+	case CaptionFunc:
+		if funcname == "" {
+			return fmt.Sprintf("%s:%d", shortPath(file), line)
+		}
+		return fmt.Sprintf("%s %s:%d", shortFuncName(funcname), shortPath(file), line)
+	case CaptionFile:
+		return fmt.Sprintf("%s:%d", shortPath(file), line)
+	default:
+		return fmt.Sprintf("%s:%d", file, line)
+	}
+}
+
+// shortFuncName removes the package path from the function name,
+// e.g. "encoding/json.(*decodeState).object" becomes "json.(*decodeState).object".
+func shortFuncName(funcname string) string {
+	slash := strings.LastIndexByte(funcname, '/')
+	if slash < 0 {
+		return funcname
+	}
+	return funcname[slash+1:]
+}
+
+// shortPath returns the file with its parent directory.
+func shortPath(file string) string {
+	dir, name := path.Split(file)
+	if dir == "" {
+		return name
+	}
+	return path.Join(path.Base(dir), name)
+}
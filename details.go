@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// Details describes the series in depth.
+//
+// It includes the totals, the peak rate and the full stacks that were
+// merged into the series.
+func (summary *Summary) Details(s *series.Series) []string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	total := s.Total
+	if len(summary.Processes) > 1 {
+		add("Process %s", summary.ProcessName(s.Process))
+	}
+	if process := summary.Process(s.Process); process != nil && process.Rate > 1 {
+		add("Estimated from allocations sampled every %s", SizeToString(int64(process.Rate)))
+	}
+	if summary.Collection.Grouping == series.GroupByType {
+		add("Type %s", TypeName(s.Type))
+	}
+	add("Allocated %s in %d objects, freed %s in %d objects",
+		SizeToString(total.AllocBytes), total.AllocObjects,
+		SizeToString(total.FreeBytes), total.FreeObjects)
+	add("Live %s in %d objects, average object size %s",
+		SizeToString(total.AllocBytes-total.FreeBytes), total.AllocObjects-total.FreeObjects,
+		SizeToString(averageSize(total.AllocBytes, total.AllocObjects)))
+
+	if leak, ok := summary.Leak(s); ok {
+		add("Live bytes growing steadily by %s (fit %.2f)", GrowthToString(leak.Growth), leak.Fit)
+	}
+
+	if lifetimes, ok := summary.Lifetimes(s); ok {
+		if freed := &lifetimes.Freed; freed.Count > 0 {
+			add("Freed objects survived GC cycles %s", freed.CyclesString())
+			add("Freed objects lived %s", freed.AgesString())
+		}
+		if unfreed := &lifetimes.Unfreed; unfreed.Count > 0 {
+			add("Never freed %d objects, survived up to %d GC cycles", unfreed.Count, unfreed.MaxCycles)
+		}
+	}
+
+	peak := s.Max()
+	perSecond := float64(time.Second) / float64(summary.Collection.SampleDuration)
+	add("Peak allocation rate %s/s in %.0f objects/s",
+		SizeToString(int64(float64(peak.AllocBytes)*perSecond)),
+		float64(peak.AllocObjects)*perSecond)
+
+	sources := append([]*series.Series{}, s.Sources...)
+	sort.SliceStable(sources, func(i, k int) bool {
+		return sources[i].Total.AllocBytes > sources[k].Total.AllocBytes
+	})
+
+	add("")
+	add("%d stacks", len(sources))
+	for i, source := range sources {
+		add("")
+		caption := fmt.Sprintf("#%d allocated %s, live %s", i+1,
+			SizeToString(source.Total.AllocBytes),
+			SizeToString(source.Total.AllocBytes-source.Total.FreeBytes))
+		if source.Type != "" {
+			caption += ", type " + source.Type
+		}
+		add("%s", caption)
+
+		stack := summary.StackAsString(source.Process, source.Stack)
+		for _, line := range strings.Split(strings.TrimSpace(stack), "\n") {
+			add("    %s", line)
+		}
+	}
+
+	return lines
+}
+
+func averageSize(bytes, objects int64) int64 {
+	if objects == 0 {
+		return 0
+	}
+	return bytes / objects
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"loov.dev/allocview/internal/pprof"
+	"loov.dev/allocview/internal/symbols"
+)
+
+// ExportPprof writes collected allocations as a gzipped pprof profile to path.
+func (summary *Summary) ExportPprof(path string) error {
+	if len(summary.Processes) == 0 {
+		return errors.New("no profiles received")
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create profile: %w", err)
+	}
+
+	err = summary.Pprof().Write(file)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to write profile: %w", err)
+	}
+
+	return file.Close()
+}
+
+// Pprof converts collected allocations to a pprof profile.
+func (summary *Summary) Pprof() *pprof.Profile {
+	collection := summary.Collection
+
+	profile := &pprof.Profile{
+		SampleTypes: []pprof.ValueType{
+			{Type: "alloc_objects", Unit: "count"},
+			{Type: "alloc_space", Unit: "bytes"},
+			{Type: "inuse_objects", Unit: "count"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		DefaultSampleType: "inuse_space",
+
+		PeriodType: pprof.ValueType{Type: "space", Unit: "bytes"},
+		Period:     1,
+
+		TimeNanos:     collection.Start.UnixNano(),
+		DurationNanos: collection.LastNow.Sub(collection.Start).Nanoseconds(),
+	}
+	if len(summary.Binaries) == 1 {
+		profile.Executable = summary.Processes[0].ExeName
+	}
+
+	for _, full := range collection.Full {
+		binary := summary.Binary(full.Process)
+		total := full.Total
+		sample := pprof.Sample{
+			Values: []int64{
+				total.AllocObjects,
+				total.AllocBytes,
+				total.AllocObjects - total.FreeObjects,
+				total.AllocBytes - total.FreeBytes,
+			},
+		}
+		for _, frame := range full.Stack {
+			sample.Stack = append(sample.Stack, pprofFrame(binary, frame))
+		}
+		profile.Samples = append(profile.Samples, sample)
+	}
+
+	return profile
+}
+
+func pprofFrame(binary *symbols.Binary, frame uintptr) pprof.Frame {
+	if binary == nil {
+		return pprof.Frame{Address: uint64(frame)}
+	}
+
+	sym, _ := binary.Frame(frame)
+	return pprof.Frame{
+		Address:  uint64(frame),
+		Function: sym.Func,
+		File:     sym.File,
+		Line:     int64(sym.Line),
+	}
+}
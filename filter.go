@@ -0,0 +1,161 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// FrameFilter decides which frames are skipped when grouping stacks.
+type FrameFilter struct {
+	// Runtime skips frames from the Go runtime.
+	Runtime bool
+	// Patterns skips frames where the function name matches any of them.
+	Patterns RegexpList
+}
+
+// Enabled returns whether any frames may be skipped.
+func (filter *FrameFilter) Enabled() bool {
+	return filter.Runtime || len(filter.Patterns) > 0
+}
+
+// Skip returns whether a frame in funcname should be skipped.
+func (filter *FrameFilter) Skip(funcname string) bool {
+	if filter.Runtime && isRuntimeFunc(funcname) {
+		return true
+	}
+	for _, rx := range filter.Patterns {
+		if rx.MatchString(funcname) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRuntimeFunc(funcname string) bool {
+	return strings.HasPrefix(funcname, "runtime.") ||
+		strings.HasPrefix(funcname, "internal/runtime/")
+}
+
+// RegexpList implements flag.Value for specifying multiple regular expressions.
+type RegexpList []*regexp.Regexp
+
+func (list *RegexpList) String() string {
+	if list == nil {
+		return ""
+	}
+	var s []string
+	for _, rx := range *list {
+		s = append(s, rx.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+func (list *RegexpList) Set(value string) error {
+	rx, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*list = append(*list, rx)
+	return nil
+}
+
+// SeriesFilter matches series based on their symbolized stacks.
+type SeriesFilter struct {
+	// Exclude hides the matching series instead of the non-matching.
+	Exclude bool
+
+	pattern string
+	regexp  bool
+	rx      *regexp.Regexp
+	err     error
+
+	// matches caches results for each series.
+	matches map[*series.Series]seriesMatch
+}
+
+type seriesMatch struct {
+	sources int
+	match   bool
+}
+
+// SetPattern updates the pattern, which is matched against function names
+// and file paths. When isRegexp is false, pattern is matched as a substring.
+func (filter *SeriesFilter) SetPattern(pattern string, isRegexp bool) {
+	if filter.pattern == pattern && filter.regexp == isRegexp {
+		return
+	}
+	filter.pattern, filter.regexp = pattern, isRegexp
+	filter.matches = nil
+
+	filter.rx, filter.err = nil, nil
+	if pattern == "" {
+		return
+	}
+	if !isRegexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	filter.rx, filter.err = regexp.Compile(pattern)
+}
+
+// Err returns the error from compiling the pattern.
+func (filter *SeriesFilter) Err() error { return filter.err }
+
+// Active returns whether the filter hides any series.
+func (filter *SeriesFilter) Active() bool { return filter.rx != nil }
+
+// Filter returns the series that should be displayed.
+func (filter *SeriesFilter) Filter(summary *Summary, list []*series.Series) []*series.Series {
+	if !filter.Active() {
+		return list
+	}
+	if filter.matches == nil || len(filter.matches) > 2*len(summary.Collection.List) {
+		filter.matches = map[*series.Series]seriesMatch{}
+	}
+
+	var result []*series.Series
+	for _, series := range list {
+		if filter.match(summary, series) != filter.Exclude {
+			result = append(result, series)
+		}
+	}
+	return result
+}
+
+// match checks whether any of the full stacks of series matches.
+func (filter *SeriesFilter) match(summary *Summary, series *series.Series) bool {
+	cached, ok := filter.matches[series]
+	if ok && cached.sources == len(series.Sources) {
+		return cached.match
+	}
+
+	match := false
+	binary := summary.Binary(series.Process)
+search:
+	for _, source := range series.Sources {
+		if source.Type != "" && filter.rx.MatchString(source.Type) {
+			match = true
+			break search
+		}
+		for _, frame := range source.Stack {
+			if binary == nil {
+				break search
+			}
+			sym, ok := binary.Frame(frame)
+			if !ok {
+				continue
+			}
+			if filter.rx.MatchString(sym.Func) || filter.rx.MatchString(sym.File) {
+				match = true
+				break search
+			}
+		}
+	}
+
+	filter.matches[series] = seriesMatch{
+		sources: len(series.Sources),
+		match:   match,
+	}
+	return match
+}
@@ -23,3 +23,8 @@ func SizeToString(bytes int64) string {
 		return fmt.Sprintf("%0.2fPB", float64(bytes)/float64(1<<50))
 	}
 }
+
+// GrowthToString formats growth in bytes per minute.
+func GrowthToString(perMinute float64) string {
+	return "+" + SizeToString(int64(perMinute)) + "/min"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"loov.dev/allocview/internal/series"
+)
+
+// Names of the gauges collected for each process.
+//
+// The names starting with "/" are from runtime/metrics, which
+// may not be available in older runtimes.
+const (
+	GaugeHeapObjects  = "/memory/classes/heap/objects:bytes"
+	GaugeHeapGoal     = "/gc/heap/goal:bytes"
+	GaugeGCCycles     = "/gc/cycles/total:gc-cycles"
+	GaugeGoroutines   = "/sched/goroutines:goroutines"
+	GaugeHeapInuse    = "memstats:HeapInuse"
+	GaugeNextGC       = "memstats:NextGC"
+	GaugePauseTotal   = "memstats:PauseTotalNs"
+	GaugeGCCPUPercent = "memstats:GCCPUFraction"
+	GaugeNumGC        = "memstats:NumGC"
+)
+
+// averagedGauges are averaged over the processes instead of summed,
+// since the sum of fractions is meaningless.
+var averagedGauges = map[string]bool{
+	GaugeGCCPUPercent: true,
+}
+
+// addGauges adds the runtime metrics of the profile.
+func (summary *Summary) addGauges(profile *Profile) {
+	gauges, ok := summary.gauges[profile.Process.ID]
+	if !ok {
+		gauges = map[string]*series.Gauge{}
+		summary.gauges[profile.Process.ID] = gauges
+	}
+
+	t := summary.Collection.SampleHead
+	set := func(name string, value float64) {
+		gauge, ok := gauges[name]
+		if !ok {
+			gauge = series.NewGauge(summary.Collection.SampleCount)
+			gauges[name] = gauge
+		}
+		gauge.Set(t, value)
+	}
+
+	for name, value := range profile.Metrics {
+		set(name, value)
+	}
+	set(GaugeHeapInuse, float64(profile.MemStats.HeapInuse))
+	set(GaugeNextGC, float64(profile.MemStats.NextGC))
+	set(GaugePauseTotal, float64(profile.MemStats.PauseTotalNs))
+	set(GaugeGCCPUPercent, profile.MemStats.GCCPUFraction*100)
+	set(GaugeNumGC, float64(profile.NumGC))
+}
+
+// Gauge returns the value of the gauge at sample time t summed over
+// the processes, process 0 includes all processes. The averagedGauges
+// are averaged instead.
+func (summary *Summary) Gauge(process int, name string, t int) (float64, bool) {
+	head := summary.Collection.SampleHead
+
+	var total float64
+	var found int
+	for id, gauges := range summary.gauges {
+		if process != 0 && id != process {
+			continue
+		}
+		gauge, ok := gauges[name]
+		if !ok {
+			continue
+		}
+		if value, ok := gauge.At(head, t); ok {
+			total += value
+			found++
+		}
+	}
+	if found > 1 && averagedGauges[name] {
+		total /= float64(found)
+	}
+	return total, found > 0
+}
+
+// GaugeOr returns the value of the first available gauge.
+func (summary *Summary) GaugeOr(process int, t int, names ...string) float64 {
+	for _, name := range names {
+		if value, ok := summary.Gauge(process, name, t); ok {
+			return value
+		}
+	}
+	return 0
+}
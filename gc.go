@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// GCEvent is a completed GC cycle of a process.
+type GCEvent struct {
+	Process int
+	Cycle   uint32
+	Pause   time.Duration
+	// End is when the cycle completed.
+	End time.Time
+	// Sample is the sample time of End.
+	Sample int
+}
+
+// addGCs adds the GC cycles completed since the previous profile.
+func (summary *Summary) addGCs(profile *Profile) {
+	collection := summary.Collection
+	for _, gc := range profile.GCs {
+		end := profile.Time.Add(-gc.Ago)
+		if end.Before(collection.Start) {
+			continue
+		}
+		summary.GCs = append(summary.GCs, GCEvent{
+			Process: profile.Process.ID,
+			Cycle:   gc.Cycle,
+			Pause:   gc.Pause,
+			End:     end,
+			Sample:  int(end.Sub(collection.Start) / collection.SampleDuration),
+		})
+	}
+
+	// forget cycles that are no longer in the ring-buffer
+	oldest := collection.SampleHead - collection.SampleCount
+	drop := 0
+	for drop < len(summary.GCs) && summary.GCs[drop].Sample <= oldest {
+		drop++
+	}
+	if drop > 0 {
+		summary.GCs = append(summary.GCs[:0], summary.GCs[drop:]...)
+	}
+}
+
+// GCsBetween returns the GC cycles of process completed in sample time range [from, to),
+// process 0 includes all processes.
+func (summary *Summary) GCsBetween(process int, from, to int) []GCEvent {
+	var gcs []GCEvent
+	for _, gc := range summary.GCs {
+		if process != 0 && gc.Process != process {
+			continue
+		}
+		if from <= gc.Sample && gc.Sample < to {
+			gcs = append(gcs, gc)
+		}
+	}
+	return gcs
+}
+
+// GCTooltip describes the GC cycles for a tooltip, starting with a newline.
+func GCTooltip(gcs []GCEvent) string {
+	const maxLines = 4
+
+	var text string
+	for i, gc := range gcs {
+		if i == maxLines {
+			text += "\n+" + strconv.Itoa(len(gcs)-maxLines) + " GC cycles"
+			break
+		}
+		text += "\nGC #" + strconv.Itoa(int(gc.Cycle)) + " at " + gc.End.Format("15:04:05.000") + ", pause " + gc.Pause.String()
+	}
+	return text
+}
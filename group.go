@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// GroupMode defines how allocations are grouped into series.
+type GroupMode int
+
+const (
+	// GroupStack groups allocations by the first frames of the stack.
+	GroupStack GroupMode = iota
+	// GroupType groups allocations by the allocated type, which is
+	// only known for traced programs.
+	GroupType
+
+	groupModeCount
+)
+
+func (mode GroupMode) String() string {
+	switch mode {
+	case GroupStack:
+		return "stack"
+	case GroupType:
+		return "type"
+	default:
+		return "invalid"
+	}
+}
+
+// Set implements flag.Value.
+func (mode *GroupMode) Set(value string) error {
+	for m := GroupMode(0); m < groupModeCount; m++ {
+		if m.String() == value {
+			*mode = m
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown group mode %q, expected stack or type", value)
+}
+
+// Next returns the next mode for cycling.
+func (mode GroupMode) Next() GroupMode {
+	return (mode + 1) % groupModeCount
+}
+
+// Grouping returns the corresponding grouping of the collection.
+func (mode GroupMode) Grouping() series.Grouping {
+	if mode == GroupType {
+		return series.GroupByType
+	}
+	return series.GroupByStack
+}
+
+// SetGroup changes the grouping of the series.
+func (summary *Summary) SetGroup(mode GroupMode) {
+	summary.Config.Group = mode
+	summary.Collection.SetGrouping(mode.Grouping())
+}
+
+// SeriesName returns the type or the stack of the series,
+// depending on the grouping.
+func (summary *Summary) SeriesName(s *series.Series) string {
+	if summary.Collection.Grouping == series.GroupByType {
+		return TypeName(s.Type) + "\n"
+	}
+	return summary.StackAsString(s.Process, s.Stack)
+}
+
+// TypeName returns a displayable name for the allocated type.
+func TypeName(typ string) string {
+	if typ == "" {
+		return "unknown type"
+	}
+	return typ
+}
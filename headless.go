@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// Headless collects profiles without displaying them.
+type Headless struct {
+	Server  *Server
+	Summary *Summary
+
+	// Top is the number of series to include in the report.
+	Top int
+}
+
+// NewHeadless returns a new headless collector.
+func NewHeadless(config Config, server *Server) *Headless {
+	return &Headless{
+		Server:  server,
+		Summary: NewSummary(config),
+		Top:     20,
+	}
+}
+
+// Run collects profiles until ctx is cancelled or done returns.
+func (headless *Headless) Run(ctx context.Context, done <-chan error) error {
+	for {
+		select {
+		case profile := <-headless.Server.Profiles():
+			headless.Summary.Add(profile)
+		case err := <-done:
+			headless.drain()
+			return err
+		case <-ctx.Done():
+			headless.drain()
+			return nil
+		}
+	}
+}
+
+// drain adds profiles that have been already received.
+func (headless *Headless) drain() {
+	for {
+		select {
+		case profile := <-headless.Server.Profiles():
+			headless.Summary.Add(profile)
+		default:
+			return
+		}
+	}
+}
+
+// WriteReport writes top series in the configured order.
+func (headless *Headless) WriteReport(w io.Writer) error {
+	metric := headless.Summary.Config.Metric
+
+	list := append([]*series.Series{}, headless.Summary.Collection.List...)
+	headless.Summary.Sort(list)
+	if headless.Top > 0 && len(list) > headless.Top {
+		list = list[:headless.Top]
+	}
+
+	multiprocess := len(headless.Summary.Processes) > 1
+
+	var s strings.Builder
+	if leaks := headless.Summary.Leaks(); len(leaks) > 0 {
+		s.WriteString("Possible leaks:\n\n")
+		for i, leak := range leaks {
+			series := leak.Series
+			fmt.Fprintf(&s, "#%d %s, live %s / %s objects", i+1,
+				GrowthToString(leak.Growth),
+				SizeToString(series.TotalAllocBytes),
+				strconv.Itoa(int(series.TotalAllocObjects)))
+			if multiprocess {
+				fmt.Fprintf(&s, " in %s", headless.Summary.ProcessName(series.Process))
+			}
+			s.WriteString("\n")
+			headless.writeStack(&s, series)
+		}
+		s.WriteString("Top series:\n\n")
+	}
+
+	for i, series := range list {
+		fmt.Fprintf(&s, "#%d %s, live %s / %s objects", i+1,
+			metric.Caption(series),
+			SizeToString(series.TotalAllocBytes),
+			strconv.Itoa(int(series.TotalAllocObjects)))
+		if multiprocess {
+			fmt.Fprintf(&s, " in %s", headless.Summary.ProcessName(series.Process))
+		}
+		s.WriteString("\n")
+		headless.writeStack(&s, series)
+	}
+
+	headless.writeUnfreed(&s)
+
+	_, err := io.WriteString(w, s.String())
+	return err
+}
+
+// writeUnfreed writes the stacks of traced objects that were never freed.
+func (headless *Headless) writeUnfreed(s *strings.Builder) {
+	summary := headless.Summary
+	unfreed := summary.Unfreed()
+	if len(unfreed) == 0 {
+		return
+	}
+	if headless.Top > 0 && len(unfreed) > headless.Top {
+		unfreed = unfreed[:headless.Top]
+	}
+
+	s.WriteString("Never freed at the end of the trace:\n\n")
+	for i, full := range unfreed {
+		lifetimes, _ := summary.Lifetimes(full)
+		fmt.Fprintf(s, "#%d %s in %d objects, survived up to %d GC cycles", i+1,
+			SizeToString(full.TotalAllocBytes),
+			lifetimes.Unfreed.Count,
+			lifetimes.Unfreed.MaxCycles)
+		if len(summary.Processes) > 1 {
+			fmt.Fprintf(s, " in %s", summary.ProcessName(full.Process))
+		}
+		s.WriteString("\n")
+		if full.Type != "" {
+			fmt.Fprintf(s, "    type %s\n", full.Type)
+		}
+		writeIndented(s, "    ", summary.StackAsString(full.Process, full.Stack))
+		s.WriteString("\n")
+	}
+}
+
+// reportTypeStacks is the number of stacks listed for each type.
+const reportTypeStacks = 3
+
+// writeStack writes indented stack of the series followed by an empty line.
+//
+// When grouping by type, the stacks that allocated the most bytes
+// of the type are written instead.
+func (headless *Headless) writeStack(s *strings.Builder, series *series.Series) {
+	summary := headless.Summary
+	if summary.Config.Group != GroupType {
+		writeIndented(s, "    ", summary.StackAsString(series.Process, series.Stack))
+		s.WriteString("\n")
+		return
+	}
+
+	fmt.Fprintf(s, "    %s\n", TypeName(series.Type))
+	sources := append(series.Sources[:0:0], series.Sources...)
+	sort.SliceStable(sources, func(i, k int) bool {
+		return sources[i].Total.AllocBytes > sources[k].Total.AllocBytes
+	})
+	for i, source := range sources {
+		if i >= reportTypeStacks {
+			fmt.Fprintf(s, "    +%d stacks\n", len(sources)-i)
+			break
+		}
+		fmt.Fprintf(s, "    %s allocated at\n", SizeToString(source.Total.AllocBytes))
+		writeIndented(s, "        ", summary.StackAsString(source.Process, source.Stack))
+	}
+	s.WriteString("\n")
+}
+
+// writeIndented writes the lines of text with the indent.
+func writeIndented(s *strings.Builder, indent, text string) {
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		fmt.Fprintf(s, "%s%s\n", indent, line)
+	}
+}
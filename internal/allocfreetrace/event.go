@@ -1,7 +1,6 @@
 package allocfreetrace
 
 import (
-	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -39,10 +38,15 @@ type Event struct {
 
 type Address uintptr
 
+// ParseEvent parses a tracealloc, tracefree or tracegc block,
+// other blocks, such as program output, are ignored.
+//
+// A GC event is written at the end of the mark phase of a GC cycle,
+// the objects found unreachable are freed afterwards.
 func ParseEvent(block string) (Event, bool) {
 	header, stack := splitBlock(block)
 	kind, address, typ, size := parseHeader(header)
-	if kind == Invalid || kind == GC {
+	if kind == Invalid {
 		return Event{}, false
 	}
 
@@ -72,32 +76,30 @@ func parseHeader(header string) (Kind, Address, string, int64) {
 		// tracealloc(0xc00005ea80, 0x180)
 		tokens := rxAlloc.FindStringSubmatch(header[p:])
 		if len(tokens) != 4 {
-			fmt.Printf("%q %v\n", header[p:], tokens)
-			panic(header)
+			return Invalid, 0, "", 0
 		}
 		address, err := strconv.ParseUint(tokens[1], 16, 64)
 		if err != nil {
-			panic(err)
+			return Invalid, 0, "", 0
 		}
 		size, err := strconv.ParseInt(tokens[2], 16, 64)
 		if err != nil {
-			panic(err)
+			return Invalid, 0, "", 0
 		}
 		return Alloc, Address(address), tokens[3], size
 	case "tracefree":
 		// tracefree(0xc0006a2090, 0x30)
 		tokens := rxFree.FindStringSubmatch(header[p:])
 		if len(tokens) != 3 {
-			fmt.Printf("%q\n", header[p:])
-			panic(header)
+			return Invalid, 0, "", 0
 		}
 		address, err := strconv.ParseUint(tokens[1], 16, 64)
 		if err != nil {
-			panic(err)
+			return Invalid, 0, "", 0
 		}
 		size, err := strconv.ParseInt(tokens[2], 16, 64)
 		if err != nil {
-			panic(err)
+			return Invalid, 0, "", 0
 		}
 		return Free, Address(address), "", size
 	case "tracegc":
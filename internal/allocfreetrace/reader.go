@@ -27,6 +27,9 @@ func NewReader(input io.Reader) *Reader {
 func (reader *Reader) Read() (Event, error) {
 tryagain:
 	if !reader.scanner.Scan() {
+		if err := reader.scanner.Err(); err != nil {
+			return Event{}, err
+		}
 		return Event{}, io.EOF
 	}
 
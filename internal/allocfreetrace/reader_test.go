@@ -0,0 +1,61 @@
+package allocfreetrace_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"loov.dev/allocview/internal/allocfreetrace"
+)
+
+func TestReader(t *testing.T) {
+	file, err := os.Open("allocfree.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	counts := map[allocfreetrace.Kind]int{}
+	reader := allocfreetrace.NewReader(file)
+	for {
+		event, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[event.Kind]++
+	}
+
+	if counts[allocfreetrace.Alloc] != 95 || counts[allocfreetrace.Free] != 24 || counts[allocfreetrace.GC] != 6 {
+		t.Errorf("got %v", counts)
+	}
+}
+
+func TestParseStack(t *testing.T) {
+	const stack = `goroutine 1 [running]:
+runtime.newobject(0x1064620, 0x100000)
+	/usr/local/go/src/runtime/malloc.go:1068 +0x38 fp=0xc00007ef50 sp=0xc00007ef20 pc=0x100a748
+main.N(...)
+	/testdata/graph.go:14
+main.(*Graph).Add(0xc000074060)
+	/testdata/graph.go:20 +0x5e
+...additional frames elided...
+created by main.main in goroutine 1
+	/testdata/graph.go:30 +0x44`
+
+	expected := []allocfreetrace.Frame{
+		{Func: "runtime.newobject", File: "/usr/local/go/src/runtime/malloc.go", Line: 1068},
+		{Func: "main.N", File: "/testdata/graph.go", Line: 14},
+		{Func: "main.(*Graph).Add", File: "/testdata/graph.go", Line: 20},
+		{Func: "main.main", File: "/testdata/graph.go", Line: 30},
+	}
+
+	got := allocfreetrace.ParseStack(stack)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v\nexpected %#v", got, expected)
+	}
+}
@@ -0,0 +1,67 @@
+package allocfreetrace
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Frame is a stack frame parsed from a traceback.
+type Frame struct {
+	Func string
+	File string
+	Line int
+}
+
+// ParseStack parses the frames of a traceback, starting from
+// the innermost frame.
+//
+// The goroutine header and frames without a location are skipped.
+func ParseStack(stack string) []Frame {
+	var frames []Frame
+
+	fn := ""
+	for len(stack) > 0 {
+		var line string
+		if p := strings.IndexByte(stack, '\n'); p >= 0 {
+			line, stack = stack[:p], stack[p+1:]
+		} else {
+			line, stack = stack, ""
+		}
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "goroutine "):
+			fn = ""
+		case line[0] == '\t':
+			// /path/to/file.go:123 +0x4b8 fp=0x7ffeefbff618 sp=0x7ffeefbff578 pc=0x100a088
+			if fn == "" {
+				continue
+			}
+			location := strings.TrimSpace(line)
+			if p := strings.IndexByte(location, ' '); p >= 0 {
+				location = location[:p]
+			}
+			file, lineno := location, 0
+			if p := strings.LastIndexByte(location, ':'); p >= 0 {
+				file = location[:p]
+				lineno, _ = strconv.Atoi(location[p+1:])
+			}
+			frames = append(frames, Frame{Func: fn, File: file, Line: lineno})
+			fn = ""
+		case strings.HasPrefix(line, "created by "):
+			// created by main.main in goroutine 1
+			fn = strings.TrimPrefix(line, "created by ")
+			if p := strings.Index(fn, " in goroutine "); p >= 0 {
+				fn = fn[:p]
+			}
+		default:
+			// main.(*Server).Run(0xc00001e000, ...)
+			fn = line
+			if p := strings.LastIndexByte(fn, '('); p > 0 && strings.HasSuffix(fn, ")") {
+				fn = fn[:p]
+			}
+		}
+	}
+
+	return frames
+}
@@ -2,7 +2,17 @@ package packet
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+)
+
+var (
+	// ErrShortPacket is returned when reading past the end of the packet.
+	ErrShortPacket = errors.New("packet too short")
+	// ErrInvalidVarint is returned when a varint is truncated or overflows.
+	ErrInvalidVarint = errors.New("invalid varint")
 )
 
 func ReadLength(r io.Reader) (int, error) {
@@ -16,9 +26,17 @@ func ReadLength(r io.Reader) (int, error) {
 	return int(v), nil
 }
 
+// Decoder decodes values from a packet.
+//
+// Reading past the end of the packet returns zero values and
+// the error is available from Err.
 type Decoder struct {
+	// MaxSize limits the size of a packet, 0 means no limit.
+	MaxSize int
+
 	off  int
 	data []byte
+	err  error
 }
 
 func (dec *Decoder) Read(r io.Reader) error {
@@ -29,9 +47,13 @@ func (dec *Decoder) Read(r io.Reader) error {
 	}
 
 	length := binary.LittleEndian.Uint32(lengthBuffer[:])
+	if dec.MaxSize > 0 && uint64(length) > uint64(dec.MaxSize) {
+		return fmt.Errorf("packet size %d exceeds limit %d", length, dec.MaxSize)
+	}
 
 	// TODO: avoid realloc
 	dec.off = 0
+	dec.err = nil
 	dec.data = make([]byte, length)
 	_, err = io.ReadFull(r, dec.data[:])
 	if err != nil {
@@ -43,24 +65,56 @@ func (dec *Decoder) Read(r io.Reader) error {
 
 func (dec *Decoder) Reset(data []byte) {
 	dec.off = 0
+	dec.err = nil
 	dec.data = data
 }
 
+// Data returns the whole packet.
+func (dec *Decoder) Data() []byte {
+	return dec.data
+}
+
+// Err returns the first error that happened while decoding.
+func (dec *Decoder) Err() error {
+	return dec.err
+}
+
+// next returns the next n bytes, or nil when the packet is too short.
+func (dec *Decoder) next(n int) []byte {
+	if dec.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(dec.data)-dec.off {
+		dec.err = ErrShortPacket
+		return nil
+	}
+	b := dec.data[dec.off : dec.off+n]
+	dec.off += n
+	return b
+}
+
 func (dec *Decoder) Byte() byte {
-	dec.off++
-	return dec.data[dec.off-1]
+	b := dec.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
 }
 
 func (dec *Decoder) Uint32() uint32 {
-	v := binary.LittleEndian.Uint32(dec.data[dec.off:])
-	dec.off += 4
-	return v
+	b := dec.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
 }
 
 func (dec *Decoder) Uint64() uint64 {
-	v := binary.LittleEndian.Uint64(dec.data[dec.off:])
-	dec.off += 8
-	return v
+	b := dec.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
 }
 
 func (dec *Decoder) Int32() int32 {
@@ -71,13 +125,45 @@ func (dec *Decoder) Int64() int64 {
 	return int64(dec.Uint64())
 }
 
+func (dec *Decoder) Float64() float64 {
+	return math.Float64frombits(dec.Uint64())
+}
+
 func (dec *Decoder) Uintptr() uintptr {
 	return uintptr(dec.Uint64())
 }
 
-func (dec *Decoder) String() string {
-	n := int(dec.Uint32())
-	b := dec.data[dec.off : dec.off+n]
+func (dec *Decoder) Uvarint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(dec.data[dec.off:])
+	if n <= 0 {
+		dec.err = ErrInvalidVarint
+		return 0
+	}
+	dec.off += n
+	return v
+}
+
+func (dec *Decoder) Varint() int64 {
+	if dec.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(dec.data[dec.off:])
+	if n <= 0 {
+		dec.err = ErrInvalidVarint
+		return 0
+	}
 	dec.off += n
-	return string(b)
+	return v
+}
+
+func (dec *Decoder) String() string {
+	return string(dec.Bytes())
+}
+
+func (dec *Decoder) Bytes() []byte {
+	n := dec.Uint32()
+	return dec.next(int(n))
 }
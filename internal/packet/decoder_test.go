@@ -0,0 +1,54 @@
+package packet_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"loov.dev/allocview/internal/packet"
+)
+
+func TestDecoderShortPacket(t *testing.T) {
+	enc := packet.NewEncoder(64)
+	enc.Uint32(7)
+	enc.String("hello")
+
+	var dec packet.Decoder
+	if err := dec.Read(bytes.NewReader(enc.LengthAndBytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := dec.Uint32(); v != 7 {
+		t.Errorf("got %d, expected 7", v)
+	}
+	if v := dec.String(); v != "hello" {
+		t.Errorf("got %q, expected hello", v)
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if v := dec.Uint64(); v != 0 {
+		t.Errorf("got %d after the end, expected 0", v)
+	}
+	if !errors.Is(dec.Err(), packet.ErrShortPacket) {
+		t.Errorf("got %v, expected ErrShortPacket", dec.Err())
+	}
+
+	// the error is sticky
+	dec.Reset([]byte{1, 0, 0, 0, 'x'})
+	_ = dec.Uint64()
+	if v := dec.String(); v != "" || dec.Err() == nil {
+		t.Errorf("got %q, %v after an error", v, dec.Err())
+	}
+}
+
+func TestDecoderMaxSize(t *testing.T) {
+	enc := packet.NewEncoder(64)
+	enc.String("too long")
+
+	dec := packet.Decoder{MaxSize: 4}
+	if err := dec.Read(bytes.NewReader(enc.LengthAndBytes())); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -1,6 +1,9 @@
 package packet
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"math"
+)
 
 type Encoder struct {
 	data []byte
@@ -47,6 +50,11 @@ func (enc *Encoder) String(v string) {
 	enc.data = append(enc.data, []byte(v)...)
 }
 
+func (enc *Encoder) Bytes(v []byte) {
+	enc.Uint32(uint32(len(v)))
+	enc.data = append(enc.data, v...)
+}
+
 func (enc *Encoder) Int32(v int32) {
 	enc.Uint32(uint32(v))
 }
@@ -58,3 +66,19 @@ func (enc *Encoder) Int64(v int64) {
 func (enc *Encoder) Uintptr(v uintptr) {
 	enc.Uint64(uint64(v))
 }
+
+func (enc *Encoder) Float64(v float64) {
+	enc.Uint64(math.Float64bits(v))
+}
+
+func (enc *Encoder) Uvarint(v uint64) {
+	var data [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(data[:], v)
+	enc.data = append(enc.data, data[:n]...)
+}
+
+func (enc *Encoder) Varint(v int64) {
+	var data [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(data[:], v)
+	enc.data = append(enc.data, data[:n]...)
+}
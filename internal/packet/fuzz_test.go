@@ -0,0 +1,94 @@
+//go:build go1.18
+// +build go1.18
+
+package packet_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"loov.dev/allocview/internal/packet"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add(uint32(0), uint64(0), int64(0), "", []byte{}, 0.0)
+	f.Add(uint32(math.MaxUint32), uint64(math.MaxUint64), int64(math.MinInt64), "alloclog", []byte{0, 1, 2}, math.Inf(-1))
+
+	f.Fuzz(func(t *testing.T, u32 uint32, u64 uint64, i64 int64, s string, b []byte, f64 float64) {
+		enc := packet.NewEncoder(0)
+		enc.Uint32(u32)
+		enc.Uvarint(u64)
+		enc.Varint(i64)
+		enc.Uint64(u64)
+		enc.Int64(i64)
+		enc.String(s)
+		enc.Bytes(b)
+		enc.Float64(f64)
+		enc.Byte(0xAB)
+
+		var dec packet.Decoder
+		if err := dec.Read(bytes.NewReader(enc.LengthAndBytes())); err != nil {
+			t.Fatal(err)
+		}
+
+		if v := dec.Uint32(); v != u32 {
+			t.Errorf("Uint32: got %v, expected %v", v, u32)
+		}
+		if v := dec.Uvarint(); v != u64 {
+			t.Errorf("Uvarint: got %v, expected %v", v, u64)
+		}
+		if v := dec.Varint(); v != i64 {
+			t.Errorf("Varint: got %v, expected %v", v, i64)
+		}
+		if v := dec.Uint64(); v != u64 {
+			t.Errorf("Uint64: got %v, expected %v", v, u64)
+		}
+		if v := dec.Int64(); v != i64 {
+			t.Errorf("Int64: got %v, expected %v", v, i64)
+		}
+		if v := dec.String(); v != s {
+			t.Errorf("String: got %q, expected %q", v, s)
+		}
+		if v := dec.Bytes(); !bytes.Equal(v, b) {
+			t.Errorf("Bytes: got %v, expected %v", v, b)
+		}
+		if v := dec.Float64(); math.Float64bits(v) != math.Float64bits(f64) {
+			t.Errorf("Float64: got %v, expected %v", v, f64)
+		}
+		if v := dec.Byte(); v != 0xAB {
+			t.Errorf("Byte: got %v, expected 0xAB", v)
+		}
+		if err := dec.Err(); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{4, 0, 0, 0, 'a', 'b'})
+	f.Add([]byte{0xFF, 0xFF, 0xFF, 0xFF, 1, 2, 3, 4, 5, 6, 7, 8})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := packet.Decoder{MaxSize: 1 << 10}
+		if err := dec.Read(bytes.NewReader(data)); err != nil {
+			return
+		}
+
+		// decoding arbitrary data must not panic
+		for dec.Err() == nil {
+			_ = dec.Byte()
+			_ = dec.String()
+			_ = dec.Uint32()
+			_ = dec.Varint()
+			_ = dec.Bytes()
+			_ = dec.Uvarint()
+			_ = dec.Uint64()
+		}
+
+		if v := dec.Uint64(); v != 0 {
+			t.Errorf("got %v after an error", v)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+// Package pprof implements writing profiles in the pprof profile.proto format.
+//
+// See https://github.com/google/pprof/blob/main/proto/profile.proto
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// ValueType describes the semantics and measurement units of a value.
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Frame is a symbolized stack frame.
+type Frame struct {
+	Address  uint64
+	Function string
+	File     string
+	Line     int64
+}
+
+// Sample is a single stack with the measured values.
+type Sample struct {
+	// Stack is ordered from the leaf to the root.
+	Stack []Frame
+	// Values correspond to Profile.SampleTypes.
+	Values []int64
+}
+
+// Profile is a simplified pprof profile.
+type Profile struct {
+	SampleTypes []ValueType
+	Samples     []Sample
+
+	// DefaultSampleType is the type shown by default.
+	DefaultSampleType string
+
+	PeriodType ValueType
+	Period     int64
+
+	TimeNanos     int64
+	DurationNanos int64
+
+	// Executable is the path of the profiled binary.
+	Executable string
+}
+
+// Write writes the gzip compressed profile to w.
+func (profile *Profile) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(profile.Encode()); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Encode encodes the profile as profile.proto.
+func (profile *Profile) Encode() []byte {
+	enc := newEncoder()
+
+	var buf buffer
+	for _, typ := range profile.SampleTypes {
+		buf.message(1, enc.valueType(typ))
+	}
+
+	for _, sample := range profile.Samples {
+		var msg buffer
+		ids := make([]uint64, 0, len(sample.Stack))
+		for _, frame := range sample.Stack {
+			ids = append(ids, enc.location(frame))
+		}
+		msg.packedUint64(1, ids)
+		values := make([]uint64, len(sample.Values))
+		for i, v := range sample.Values {
+			values[i] = uint64(v)
+		}
+		msg.packedUint64(2, values)
+		buf.message(2, msg.data)
+	}
+
+	{ // mapping
+		var msg buffer
+		msg.uint64(1, 1)
+		msg.int64(5, enc.str(profile.Executable))
+		msg.bool(7, true)
+		msg.bool(8, true)
+		msg.bool(9, true)
+		buf.message(3, msg.data)
+	}
+
+	for _, loc := range enc.locations {
+		buf.message(4, loc)
+	}
+	for _, fn := range enc.functions {
+		buf.message(5, fn)
+	}
+
+	if profile.TimeNanos != 0 {
+		buf.int64(9, profile.TimeNanos)
+	}
+	if profile.DurationNanos != 0 {
+		buf.int64(10, profile.DurationNanos)
+	}
+	buf.message(11, enc.valueType(profile.PeriodType))
+	buf.int64(12, profile.Period)
+	if profile.DefaultSampleType != "" {
+		buf.int64(14, enc.str(profile.DefaultSampleType))
+	}
+
+	// string table must be the last, since the previous
+	// encoding steps add new strings
+	for _, s := range enc.strings {
+		buf.string(6, s)
+	}
+
+	return buf.data
+}
+
+// encoder deduplicates strings, functions and locations.
+type encoder struct {
+	strings     []string
+	stringIndex map[string]int64
+
+	functions     [][]byte
+	functionIndex map[[2]string]uint64
+
+	locations     [][]byte
+	locationIndex map[Frame]uint64
+}
+
+func newEncoder() *encoder {
+	return &encoder{
+		strings:       []string{""},
+		stringIndex:   map[string]int64{"": 0},
+		functionIndex: map[[2]string]uint64{},
+		locationIndex: map[Frame]uint64{},
+	}
+}
+
+func (enc *encoder) str(s string) int64 {
+	if index, ok := enc.stringIndex[s]; ok {
+		return index
+	}
+	index := int64(len(enc.strings))
+	enc.strings = append(enc.strings, s)
+	enc.stringIndex[s] = index
+	return index
+}
+
+func (enc *encoder) valueType(typ ValueType) []byte {
+	var msg buffer
+	msg.int64(1, enc.str(typ.Type))
+	msg.int64(2, enc.str(typ.Unit))
+	return msg.data
+}
+
+func (enc *encoder) function(name, file string) uint64 {
+	key := [2]string{name, file}
+	if id, ok := enc.functionIndex[key]; ok {
+		return id
+	}
+	id := uint64(len(enc.functions) + 1)
+	enc.functionIndex[key] = id
+
+	var msg buffer
+	msg.uint64(1, id)
+	msg.int64(2, enc.str(name))
+	msg.int64(3, enc.str(name))
+	msg.int64(4, enc.str(file))
+	enc.functions = append(enc.functions, msg.data)
+	return id
+}
+
+func (enc *encoder) location(frame Frame) uint64 {
+	if id, ok := enc.locationIndex[frame]; ok {
+		return id
+	}
+	id := uint64(len(enc.locations) + 1)
+	enc.locationIndex[frame] = id
+
+	var msg buffer
+	msg.uint64(1, id)
+	msg.uint64(2, 1)
+	msg.uint64(3, frame.Address)
+	if frame.Function != "" || frame.File != "" {
+		var line buffer
+		line.uint64(1, enc.function(frame.Function, frame.File))
+		line.int64(2, frame.Line)
+		msg.message(4, line.data)
+	}
+	enc.locations = append(enc.locations, msg.data)
+	return id
+}
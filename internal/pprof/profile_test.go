@@ -0,0 +1,325 @@
+package pprof_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"loov.dev/allocview/internal/pprof"
+)
+
+func TestEncode(t *testing.T) {
+	root := pprof.Frame{Address: 0x1000, Function: "main.main", File: "main.go", Line: 10}
+	alloc := pprof.Frame{Address: 0x2000, Function: "main.alloc", File: "alloc.go", Line: 20}
+	unknown := pprof.Frame{Address: 0x3000}
+
+	profile := &pprof.Profile{
+		SampleTypes: []pprof.ValueType{
+			{Type: "alloc_space", Unit: "bytes"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		Samples: []pprof.Sample{
+			{Stack: []pprof.Frame{alloc, root}, Values: []int64{100, 0}},
+			{Stack: []pprof.Frame{unknown, root}, Values: []int64{7, 3}},
+		},
+		DefaultSampleType: "inuse_space",
+		PeriodType:        pprof.ValueType{Type: "space", Unit: "bytes"},
+		Period:            512 << 10,
+		TimeNanos:         1e18,
+		Executable:        "/bin/program",
+	}
+
+	var compressed bytes.Buffer
+	if err := profile.Write(&compressed); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := decodeProfile(t, data)
+	if len(got.strings) == 0 || got.strings[0] != "" {
+		t.Fatalf("string table must start with an empty string: %q", got.strings)
+	}
+	seen := map[string]bool{}
+	for _, s := range got.strings {
+		if seen[s] {
+			t.Errorf("duplicate string %q", s)
+		}
+		seen[s] = true
+	}
+
+	if types := got.valueTypes(got.sampleTypes); !reflect.DeepEqual(types, []string{"alloc_space/bytes", "inuse_space/bytes"}) {
+		t.Errorf("got sample types %q", types)
+	}
+	if period := got.valueTypes([][]uint64{got.periodType}); period[0] != "space/bytes" || got.period != 512<<10 {
+		t.Errorf("got period %d %s", got.period, period[0])
+	}
+	if def := got.str(got.defaultSampleType); def != "inuse_space" {
+		t.Errorf("got default sample type %q", def)
+	}
+	if got.timeNanos != 1e18 {
+		t.Errorf("got time %d", got.timeNanos)
+	}
+	if exe := got.str(got.mappingFile); exe != "/bin/program" {
+		t.Errorf("got executable %q", exe)
+	}
+
+	expected := []string{
+		"main.alloc alloc.go:20 0x2000; main.main main.go:10 0x1000 = [100 0]",
+		"? 0x3000; main.main main.go:10 0x1000 = [7 3]",
+	}
+	var samples []string
+	for _, sample := range got.samples {
+		samples = append(samples, got.sampleString(t, sample))
+	}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("got samples\n%q\nexpected\n%q", samples, expected)
+	}
+
+	// main.main is shared by both samples
+	if len(got.locations) != 3 || len(got.functions) != 2 {
+		t.Errorf("got %d locations and %d functions, expected 3 and 2", len(got.locations), len(got.functions))
+	}
+}
+
+// decoded contains the fields of profile.proto checked by the test.
+type decoded struct {
+	strings []string
+
+	sampleTypes [][]uint64
+	samples     []decodedSample
+	locations   map[uint64]decodedLocation
+	functions   map[uint64]decodedFunction
+
+	mappingFile       uint64
+	periodType        []uint64
+	period            uint64
+	defaultSampleType uint64
+	timeNanos         uint64
+}
+
+type decodedSample struct {
+	locations []uint64
+	values    []uint64
+}
+
+type decodedLocation struct {
+	address  uint64
+	function uint64
+	line     uint64
+}
+
+type decodedFunction struct {
+	name, file uint64
+}
+
+func decodeProfile(t *testing.T, data []byte) *decoded {
+	t.Helper()
+	profile := &decoded{
+		locations: map[uint64]decodedLocation{},
+		functions: map[uint64]decodedFunction{},
+	}
+
+	for _, f := range readFields(t, data) {
+		switch f.num {
+		case 1:
+			profile.sampleTypes = append(profile.sampleTypes, readValueType(t, f.bytes))
+		case 2:
+			var sample decodedSample
+			for _, sf := range readFields(t, f.bytes) {
+				switch sf.num {
+				case 1:
+					sample.locations = append(sample.locations, sf.uints(t)...)
+				case 2:
+					sample.values = append(sample.values, sf.uints(t)...)
+				}
+			}
+			profile.samples = append(profile.samples, sample)
+		case 3:
+			for _, mf := range readFields(t, f.bytes) {
+				if mf.num == 5 {
+					profile.mappingFile = mf.varint
+				}
+			}
+		case 4:
+			var id uint64
+			var loc decodedLocation
+			for _, lf := range readFields(t, f.bytes) {
+				switch lf.num {
+				case 1:
+					id = lf.varint
+				case 3:
+					loc.address = lf.varint
+				case 4:
+					for _, line := range readFields(t, lf.bytes) {
+						switch line.num {
+						case 1:
+							loc.function = line.varint
+						case 2:
+							loc.line = line.varint
+						}
+					}
+				}
+			}
+			if _, exists := profile.locations[id]; id == 0 || exists {
+				t.Errorf("invalid location id %d", id)
+			}
+			profile.locations[id] = loc
+		case 5:
+			var id uint64
+			var fn decodedFunction
+			for _, ff := range readFields(t, f.bytes) {
+				switch ff.num {
+				case 1:
+					id = ff.varint
+				case 2:
+					fn.name = ff.varint
+				case 4:
+					fn.file = ff.varint
+				}
+			}
+			if _, exists := profile.functions[id]; id == 0 || exists {
+				t.Errorf("invalid function id %d", id)
+			}
+			profile.functions[id] = fn
+		case 6:
+			profile.strings = append(profile.strings, string(f.bytes))
+		case 9:
+			profile.timeNanos = f.varint
+		case 11:
+			profile.periodType = readValueType(t, f.bytes)
+		case 12:
+			profile.period = f.varint
+		case 14:
+			profile.defaultSampleType = f.varint
+		}
+	}
+	return profile
+}
+
+func readValueType(t *testing.T, data []byte) []uint64 {
+	typ := make([]uint64, 2)
+	for _, f := range readFields(t, data) {
+		if f.num == 1 || f.num == 2 {
+			typ[f.num-1] = f.varint
+		}
+	}
+	return typ
+}
+
+func (profile *decoded) str(index uint64) string {
+	if index >= uint64(len(profile.strings)) {
+		return "<invalid string index>"
+	}
+	return profile.strings[index]
+}
+
+func (profile *decoded) valueTypes(types [][]uint64) []string {
+	var names []string
+	for _, typ := range types {
+		names = append(names, profile.str(typ[0])+"/"+profile.str(typ[1]))
+	}
+	return names
+}
+
+func (profile *decoded) sampleString(t *testing.T, sample decodedSample) string {
+	var s string
+	for i, id := range sample.locations {
+		if i > 0 {
+			s += "; "
+		}
+		loc, ok := profile.locations[id]
+		if !ok {
+			t.Errorf("unknown location %d", id)
+			continue
+		}
+		if loc.function == 0 {
+			s += "?"
+		} else {
+			fn, ok := profile.functions[loc.function]
+			if !ok {
+				t.Errorf("unknown function %d", loc.function)
+				continue
+			}
+			s += fmt.Sprintf("%s %s:%d", profile.str(fn.name), profile.str(fn.file), loc.line)
+		}
+		s += fmt.Sprintf(" %#x", loc.address)
+	}
+	return s + fmt.Sprintf(" = %v", sample.values)
+}
+
+// field is a decoded protobuf field, varint is set for varint fields
+// and bytes for length delimited fields.
+type field struct {
+	num    int
+	varint uint64
+	bytes  []byte
+	packed bool
+}
+
+// uints returns the values of a packed or a non-packed repeated field.
+func (f field) uints(t *testing.T) []uint64 {
+	if !f.packed {
+		return []uint64{f.varint}
+	}
+	var values []uint64
+	for data := f.bytes; len(data) > 0; {
+		v, n := readVarint(t, data)
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values
+}
+
+func readFields(t *testing.T, data []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(data) > 0 {
+		tag, n := readVarint(t, data)
+		data = data[n:]
+
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.varint, n = readVarint(t, data)
+			data = data[n:]
+		case 2:
+			size, n := readVarint(t, data)
+			data = data[n:]
+			if size > uint64(len(data)) {
+				t.Fatalf("field %d: length %d exceeds the message", f.num, size)
+			}
+			f.bytes, f.packed = data[:size], true
+			data = data[size:]
+		default:
+			t.Fatalf("field %d: unexpected wire type %d", f.num, tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, int) {
+	t.Helper()
+	var v uint64
+	for i, b := range data {
+		if i >= 10 {
+			break
+		}
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	t.Fatal("invalid varint")
+	return 0, 0
+}
@@ -0,0 +1,69 @@
+package pprof
+
+// buffer implements the subset of protobuf wire encoding needed by profile.proto.
+type buffer struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (buf *buffer) varint(v uint64) {
+	for v >= 0x80 {
+		buf.data = append(buf.data, byte(v)|0x80)
+		v >>= 7
+	}
+	buf.data = append(buf.data, byte(v))
+}
+
+func (buf *buffer) tag(field int, wire int) {
+	buf.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (buf *buffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	buf.tag(field, wireVarint)
+	buf.varint(v)
+}
+
+func (buf *buffer) int64(field int, v int64) {
+	buf.uint64(field, uint64(v))
+}
+
+func (buf *buffer) bool(field int, v bool) {
+	if v {
+		buf.uint64(field, 1)
+	}
+}
+
+func (buf *buffer) bytes(field int, v []byte) {
+	buf.tag(field, wireBytes)
+	buf.varint(uint64(len(v)))
+	buf.data = append(buf.data, v...)
+}
+
+// string always encodes the value, since the string table must include empty strings.
+func (buf *buffer) string(field int, v string) {
+	buf.tag(field, wireBytes)
+	buf.varint(uint64(len(v)))
+	buf.data = append(buf.data, v...)
+}
+
+func (buf *buffer) message(field int, msg []byte) {
+	buf.bytes(field, msg)
+}
+
+func (buf *buffer) packedUint64(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed buffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	buf.bytes(field, packed.data)
+}
@@ -0,0 +1,86 @@
+// Package protocol defines the handshake and the profiles sent from the agent to the viewer.
+//
+// The agent starts by sending a hello packet:
+//
+//	String  AgentMagic
+//	Uint32  Version
+//	Uint32  Features supported by the agent
+//	String  executable path
+//	String  function name and Uintptr function address, for relocating the stacks
+//	Uint32  process id
+//	Uint32  MemProfileRate
+//
+// The viewer replies with:
+//
+//	String  ViewerMagic
+//	Uint32  Version
+//	Uint32  Features enabled for the connection
+//	String  error message, empty when the agent is accepted
+//
+// Afterwards the agent sends profiles, which contain the sections for
+// the enabled features. Each stack is sent only once with an id and
+// afterwards the profiles only contain the changed counters of the stacks,
+// see RecordEncoder.
+package protocol
+
+import "strings"
+
+const (
+	// AgentMagic starts the hello packet of the agent.
+	AgentMagic = "allocview-agent"
+	// ViewerMagic starts the reply of the viewer.
+	ViewerMagic = "allocview-viewer"
+
+	// LegacyMagic was used by agents before the protocol was versioned.
+	LegacyMagic = "alloclog"
+
+	// Version is the protocol version, agents and viewers
+	// with different versions are not compatible.
+	Version = 2
+
+	// MaxHandshakeSize is the maximum size of the handshake packets.
+	MaxHandshakeSize = 64 << 10
+	// MaxPacketSize is the default maximum size of the profile packets.
+	MaxPacketSize = 64 << 20
+)
+
+// Features are optional parts of the protocol.
+type Features uint32
+
+const (
+	// FeatureMetrics adds runtime/metrics and MemStats sections to profiles.
+	FeatureMetrics Features = 1 << iota
+	// FeatureGCs adds completed GC cycles to profiles.
+	FeatureGCs
+)
+
+// Supported contains all features implemented by this version.
+const Supported = FeatureMetrics | FeatureGCs
+
+// Has returns whether all of the features in v are enabled.
+func (features Features) Has(v Features) bool {
+	return features&v == v
+}
+
+func (features Features) String() string {
+	var names []string
+	if features.Has(FeatureMetrics) {
+		names = append(names, "metrics")
+	}
+	if features.Has(FeatureGCs) {
+		names = append(names, "gcs")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseAddr splits addresses in the form "tcp://host:port" or "unix:///path"
+// into the network and the address, addresses without a network use tcp.
+func ParseAddr(addr string) (network, address string) {
+	if p := strings.Index(addr, "://"); p >= 0 {
+		return addr[:p], addr[p+3:]
+	}
+	return "tcp", addr
+}
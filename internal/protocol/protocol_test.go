@@ -0,0 +1,23 @@
+package protocol_test
+
+import (
+	"testing"
+
+	"loov.dev/allocview/internal/protocol"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr, network, address string
+	}{
+		{"tcp://localhost:8080", "tcp", "localhost:8080"},
+		{"unix:///tmp/allocview.sock", "unix", "/tmp/allocview.sock"},
+		{"localhost:8080", "tcp", "localhost:8080"},
+	}
+	for _, test := range tests {
+		network, address := protocol.ParseAddr(test.addr)
+		if network != test.network || address != test.address {
+			t.Errorf("%q: got %q %q, expected %q %q", test.addr, network, address, test.network, test.address)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+
+	"loov.dev/allocview/internal/packet"
+)
+
+// counts contains the cumulative counters of a stack.
+type counts struct {
+	allocBytes, freeBytes     int64
+	allocObjects, freeObjects int64
+}
+
+// RecordEncoder encodes the records section of the profiles.
+//
+// It tracks what has been sent to the viewer, so that
+// only the new stacks and the changed counters need to be sent.
+type RecordEncoder struct {
+	rate int
+
+	ids    map[[32]uintptr]uint32
+	stacks [][32]uintptr
+	// sent contains the counters last sent for each stack id.
+	sent []counts
+
+	current   []counts
+	newStacks []uint32
+	changed   []uint32
+}
+
+// NewRecordEncoder returns an encoder for records sampled with
+// the MemProfileRate rate.
+func NewRecordEncoder(rate int) *RecordEncoder {
+	return &RecordEncoder{
+		rate: rate,
+		ids:  map[[32]uintptr]uint32{},
+	}
+}
+
+// Encode encodes the records section of a profile.
+//
+// The stacks are sent once with an id and the counters as varint
+// differences to the previously sent values:
+//
+//	Uvarint  number of new stacks
+//	         Uvarint id, Uvarint frame count, Uvarint frames
+//	Uvarint  number of changed stacks
+//	         Uvarint id, Varint alloc bytes, free bytes, alloc objects, free objects
+//
+// The runtime keeps a separate record for each allocation size, so
+// records with the same stack are combined.
+func (encoder *RecordEncoder) Encode(enc *packet.Encoder, records []runtime.MemProfileRecord) {
+	for i := range encoder.current {
+		encoder.current[i] = counts{}
+	}
+	encoder.newStacks = encoder.newStacks[:0]
+
+	for i := range records {
+		rec := &records[i]
+		id, ok := encoder.ids[rec.Stack0]
+		if !ok {
+			id = uint32(len(encoder.stacks))
+			encoder.ids[rec.Stack0] = id
+			encoder.stacks = append(encoder.stacks, rec.Stack0)
+			encoder.sent = append(encoder.sent, counts{})
+			encoder.current = append(encoder.current, counts{})
+			encoder.newStacks = append(encoder.newStacks, id)
+		}
+
+		c := &encoder.current[id]
+		allocBytes, allocObjects := scale(rec.AllocBytes, rec.AllocObjects, encoder.rate)
+		freeBytes, freeObjects := scale(rec.FreeBytes, rec.FreeObjects, encoder.rate)
+		c.allocBytes += allocBytes
+		c.allocObjects += allocObjects
+		c.freeBytes += freeBytes
+		c.freeObjects += freeObjects
+	}
+
+	enc.Uvarint(uint64(len(encoder.newStacks)))
+	for _, id := range encoder.newStacks {
+		stack := &encoder.stacks[id]
+		n := 0
+		for n < len(stack) && stack[n] != 0 {
+			n++
+		}
+		enc.Uvarint(uint64(id))
+		enc.Uvarint(uint64(n))
+		for _, frame := range stack[:n] {
+			enc.Uvarint(uint64(frame))
+		}
+	}
+
+	// the runtime never removes records, so stacks missing from
+	// the records, e.g. when the profile wasn't read, are unchanged
+	encoder.changed = encoder.changed[:0]
+	for id := range encoder.current {
+		if encoder.current[id] != encoder.sent[id] && encoder.current[id] != (counts{}) {
+			encoder.changed = append(encoder.changed, uint32(id))
+		}
+	}
+
+	enc.Uvarint(uint64(len(encoder.changed)))
+	for _, id := range encoder.changed {
+		next, last := encoder.current[id], encoder.sent[id]
+		enc.Uvarint(uint64(id))
+		enc.Varint(next.allocBytes - last.allocBytes)
+		enc.Varint(next.freeBytes - last.freeBytes)
+		enc.Varint(next.allocObjects - last.allocObjects)
+		enc.Varint(next.freeObjects - last.freeObjects)
+		encoder.sent[id] = next
+	}
+}
+
+// scale estimates the totals from a sampled profile record,
+// the same way as pprof does.
+func scale(bytes, objects int64, rate int) (int64, int64) {
+	if rate <= 1 || objects == 0 || bytes == 0 {
+		return bytes, objects
+	}
+	average := float64(bytes) / float64(objects)
+	s := 1 / (1 - math.Exp(-average/float64(rate)))
+	return int64(float64(bytes) * s), int64(float64(objects) * s)
+}
+
+// RecordDecoder decodes the records section of the profiles
+// sent by a single process.
+type RecordDecoder struct {
+	// stacks contains the stacks sent by the process, indexed by id.
+	stacks [][32]uintptr
+}
+
+// Decode decodes the records section of a profile, the records
+// contain the changes of the counters since the previous profile.
+func (decoder *RecordDecoder) Decode(dec *packet.Decoder) ([]runtime.MemProfileRecord, error) {
+	// the counts are not trusted for preallocating, because
+	// the decoder stops at the end of a truncated packet
+	newStacks := dec.Uvarint()
+	for i := uint64(0); i < newStacks && dec.Err() == nil; i++ {
+		id := dec.Uvarint()
+		if id != uint64(len(decoder.stacks)) {
+			return nil, fmt.Errorf("unexpected stack id %d", id)
+		}
+		frames := dec.Uvarint()
+		if frames > 32 {
+			return nil, errors.New("stack too deep")
+		}
+
+		var stack [32]uintptr
+		for k := range stack[:frames] {
+			stack[k] = uintptr(dec.Uvarint())
+		}
+		decoder.stacks = append(decoder.stacks, stack)
+	}
+
+	var records []runtime.MemProfileRecord
+	changed := dec.Uvarint()
+	for i := uint64(0); i < changed && dec.Err() == nil; i++ {
+		id := dec.Uvarint()
+		if id >= uint64(len(decoder.stacks)) {
+			return nil, fmt.Errorf("unknown stack id %d", id)
+		}
+
+		records = append(records, runtime.MemProfileRecord{
+			AllocBytes:   dec.Varint(),
+			FreeBytes:    dec.Varint(),
+			AllocObjects: dec.Varint(),
+			FreeObjects:  dec.Varint(),
+			Stack0:       decoder.stacks[id],
+		})
+	}
+
+	return records, dec.Err()
+}
@@ -0,0 +1,94 @@
+package protocol_test
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"loov.dev/allocview/internal/packet"
+	"loov.dev/allocview/internal/protocol"
+)
+
+func TestRecordsRoundTrip(t *testing.T) {
+	record := func(allocBytes, freeBytes, allocObjects, freeObjects int64, stack ...uintptr) runtime.MemProfileRecord {
+		rec := runtime.MemProfileRecord{
+			AllocBytes:   allocBytes,
+			FreeBytes:    freeBytes,
+			AllocObjects: allocObjects,
+			FreeObjects:  freeObjects,
+		}
+		copy(rec.Stack0[:], stack)
+		return rec
+	}
+
+	ticks := []struct {
+		name    string
+		records []runtime.MemProfileRecord
+		expect  []runtime.MemProfileRecord
+	}{{
+		name: "new stacks",
+		records: []runtime.MemProfileRecord{
+			record(64, 0, 4, 0, 1, 2),
+			record(100, 50, 10, 5, 3),
+			// the runtime keeps a record for each size
+			record(256, 128, 2, 1, 1, 2),
+		},
+		expect: []runtime.MemProfileRecord{
+			record(320, 128, 6, 1, 1, 2),
+			record(100, 50, 10, 5, 3),
+		},
+	}, {
+		name: "changed and unchanged stacks",
+		records: []runtime.MemProfileRecord{
+			record(96, 32, 6, 2, 1, 2),
+			record(100, 50, 10, 5, 3),
+			record(256, 256, 2, 2, 1, 2),
+			record(8, 0, 1, 0, 4, 5, 6),
+		},
+		expect: []runtime.MemProfileRecord{
+			record(32, 160, 2, 3, 1, 2),
+			record(8, 0, 1, 0, 4, 5, 6),
+		},
+	}, {
+		name: "no records",
+	}, {
+		name: "counters after a tick without records",
+		records: []runtime.MemProfileRecord{
+			record(352, 288, 8, 4, 1, 2),
+			record(200, 150, 20, 15, 3),
+			record(8, 0, 1, 0, 4, 5, 6),
+		},
+		expect: []runtime.MemProfileRecord{
+			record(100, 100, 10, 10, 3),
+		},
+	}}
+
+	encoder := protocol.NewRecordEncoder(1)
+	var decoder protocol.RecordDecoder
+	for _, tick := range ticks {
+		enc := packet.NewEncoder(1 << 10)
+		encoder.Encode(&enc, tick.records)
+		enc.Uint32(0xfeed)
+
+		var dec packet.Decoder
+		if err := dec.Read(bytes.NewReader(enc.LengthAndBytes())); err != nil {
+			t.Fatalf("%s: %v", tick.name, err)
+		}
+		got, err := decoder.Decode(&dec)
+		if err != nil {
+			t.Fatalf("%s: %v", tick.name, err)
+		}
+		if end := dec.Uint32(); end != 0xfeed {
+			t.Errorf("%s: records section decoded to a wrong length", tick.name)
+		}
+
+		if len(got) != len(tick.expect) {
+			t.Fatalf("%s: got %d records, expected %d", tick.name, len(got), len(tick.expect))
+		}
+		for i := range got {
+			if got[i] != tick.expect[i] {
+				t.Errorf("%s: record %d got %+v, expected %+v", tick.name, i, got[i], tick.expect[i])
+			}
+		}
+	}
+}
@@ -38,14 +38,28 @@ func (coll *Collection) UpdateToTime(now time.Time) SampleIndex {
 
 	// clear any old samples that were skipped
 	if coll.SampleHead != sampleTime {
-		// TODO: optimize this loop
-		for _, s := range coll.List {
-			for t := coll.SampleHead + 1; t < sampleTime; t++ {
-				s.Samples[t%len(s.Samples)] = Sample{}
-			}
-		}
+		clearSamples(coll.List, coll.SampleHead, sampleTime)
 		coll.SampleHead = sampleTime
 	}
 
 	return SampleIndex(sampleTime % coll.SampleCount)
 }
+
+// SampleTime returns the wall-clock start of the sample time t.
+func (coll *Collection) SampleTime(t int) time.Time {
+	return coll.Start.Add(time.Duration(t) * coll.SampleDuration)
+}
+
+// clearSamples clears samples after head up to and including sampleTime.
+func clearSamples(list []*Series, head, sampleTime int) {
+	for _, s := range list {
+		from := head + 1
+		if sampleTime-from >= len(s.Samples) {
+			from = sampleTime - len(s.Samples) + 1
+		}
+		// TODO: optimize this loop
+		for t := from; t <= sampleTime; t++ {
+			s.Samples[t%len(s.Samples)] = Sample{}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package series
+
+// Gauge is a ring-buffer of the latest value of a measurement in each sample.
+//
+// Samples without a measurement keep the previous value.
+type Gauge struct {
+	Values []float64
+
+	// first and last are the sample times of the first and the latest measurement.
+	first, last int
+	measured    bool
+}
+
+// NewGauge returns a gauge with count samples.
+func NewGauge(count int) *Gauge {
+	return &Gauge{Values: make([]float64, count)}
+}
+
+// Set sets the value at sample time t.
+func (gauge *Gauge) Set(t int, value float64) {
+	if !gauge.measured {
+		gauge.measured = true
+		gauge.first, gauge.last = t, t
+	}
+
+	// fill the skipped samples with the previous value
+	from := gauge.last + 1
+	if t-from >= len(gauge.Values) {
+		from = t - len(gauge.Values) + 1
+	}
+	previous := gauge.Values[Mod(gauge.last, len(gauge.Values))]
+	for p := from; p < t; p++ {
+		gauge.Values[Mod(p, len(gauge.Values))] = previous
+	}
+
+	if t > gauge.last {
+		gauge.last = t
+	}
+	gauge.Values[Mod(t, len(gauge.Values))] = value
+}
+
+// At returns the value at sample time t, where head is the latest sample time.
+// It returns false when there's no measurement at that time.
+func (gauge *Gauge) At(head, t int) (float64, bool) {
+	if !gauge.measured || t < gauge.first || t <= head-len(gauge.Values) {
+		return 0, false
+	}
+	if t > gauge.last {
+		t = gauge.last
+	}
+	return gauge.Values[Mod(t, len(gauge.Values))], true
+}
+
+// Mod returns a modulo b, which is never negative for a positive b.
+func Mod(a, b int) int {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
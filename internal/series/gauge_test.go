@@ -0,0 +1,29 @@
+package series_test
+
+import (
+	"testing"
+
+	"loov.dev/allocview/internal/series"
+)
+
+func TestGauge(t *testing.T) {
+	gauge := series.NewGauge(4)
+	gauge.Set(2, 10)
+	gauge.Set(5, 20)
+
+	expect := func(head, at int, value float64, ok bool) {
+		t.Helper()
+		got, gotok := gauge.At(head, at)
+		if got != value || gotok != ok {
+			t.Errorf("At(%d, %d) = %v, %v; expected %v, %v", head, at, got, gotok, value, ok)
+		}
+	}
+
+	expect(5, 1, 0, false)
+	expect(5, 2, 10, true)
+	expect(5, 3, 10, true)
+	expect(5, 4, 10, true)
+	expect(5, 5, 20, true)
+	expect(6, 2, 0, false) // no longer in the ring-buffer
+	expect(6, 6, 20, true)
+}
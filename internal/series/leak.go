@@ -0,0 +1,137 @@
+package series
+
+import (
+	"sort"
+	"time"
+)
+
+// LeakDetector flags series whose live bytes grow steadily.
+//
+// The live bytes of a series are reconstructed from the samples in the
+// ring-buffer and a linear trend is fitted over the last Window samples.
+type LeakDetector struct {
+	// Window is the number of samples used for fitting the trend.
+	Window int
+	// MinSamples is the minimum number of samples needed for detection.
+	MinSamples int
+	// MinFit is the minimum coefficient of determination (R²) of the trend.
+	MinFit float64
+	// MinGrowth is the minimum growth of live bytes over the window.
+	MinGrowth int64
+}
+
+// NewLeakDetector returns a detector using the specified window.
+func NewLeakDetector(window int) *LeakDetector {
+	return &LeakDetector{
+		Window:     window,
+		MinSamples: 10,
+		MinFit:     0.8,
+		MinGrowth:  1 << 10,
+	}
+}
+
+// Leak describes a series with steadily growing live bytes.
+type Leak struct {
+	Series *Series
+	// Growth is the estimated growth of live bytes per minute.
+	Growth float64
+	// Fit is the coefficient of determination (R²) of the trend.
+	Fit float64
+}
+
+// Detect returns leaking series from list, sorted by growth.
+func (detector *LeakDetector) Detect(coll *Collection, list []*Series) []Leak {
+	var leaks []Leak
+	var live []int64
+	for _, s := range list {
+		live = LiveBytes(coll, s, detector.Window, live[:0])
+		if leak, ok := detector.check(coll, live); ok {
+			leak.Series = s
+			leaks = append(leaks, leak)
+		}
+	}
+	sort.SliceStable(leaks, func(i, k int) bool {
+		return leaks[i].Growth > leaks[k].Growth
+	})
+	return leaks
+}
+
+// check fits a trend to live bytes.
+func (detector *LeakDetector) check(coll *Collection, live []int64) (Leak, bool) {
+	if len(live) < detector.MinSamples || len(live) < 2 {
+		return Leak{}, false
+	}
+	if live[len(live)-1]-live[0] < detector.MinGrowth {
+		return Leak{}, false
+	}
+
+	slope, fit := linearFit(live)
+	if slope <= 0 || fit < detector.MinFit {
+		return Leak{}, false
+	}
+
+	return Leak{
+		Growth: slope * float64(time.Minute) / float64(coll.SampleDuration),
+		Fit:    fit,
+	}, true
+}
+
+// LiveBytes appends live bytes at the end of each of the last window
+// samples of s to dst, starting from the oldest.
+//
+// Samples that haven't been collected yet or are no longer in the
+// ring-buffer are not included.
+func LiveBytes(coll *Collection, s *Series, window int, dst []int64) []int64 {
+	if window > len(s.Samples) {
+		window = len(s.Samples)
+	}
+	if window > coll.SampleHead+1 {
+		window = coll.SampleHead + 1
+	}
+	if window <= 0 {
+		return dst
+	}
+
+	start := len(dst)
+	for i := 0; i < window; i++ {
+		dst = append(dst, 0)
+	}
+	live := dst[start:]
+
+	// walk backwards from the current total
+	total := s.TotalAllocBytes
+	for i := window - 1; i >= 0; i-- {
+		live[i] = total
+		sample := s.Samples[(coll.SampleHead-(window-1-i))%len(s.Samples)]
+		total -= sample.AllocBytes - sample.FreeBytes
+	}
+	return dst
+}
+
+// linearFit calculates the least squares slope of values and
+// the coefficient of determination.
+func linearFit(values []int64) (slope, fit float64) {
+	n := float64(len(values))
+
+	var sumx, sumy float64
+	for i, v := range values {
+		sumx += float64(i)
+		sumy += float64(v)
+	}
+	meanx, meany := sumx/n, sumy/n
+
+	var sxx, sxy, syy float64
+	for i, v := range values {
+		dx, dy := float64(i)-meanx, float64(v)-meany
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, 0
+	}
+
+	slope = sxy / sxx
+	fit = sxy * sxy / (sxx * syy)
+	return slope, fit
+}
@@ -0,0 +1,37 @@
+package series_test
+
+import (
+	"testing"
+	"time"
+
+	"loov.dev/allocview/internal/series"
+)
+
+func TestLeakDetector(t *testing.T) {
+	start := time.Now()
+	coll := series.NewStackCollection(start, time.Second, 64, 1)
+
+	for i := 0; i < 30; i++ {
+		index := coll.UpdateToTime(start.Add(time.Duration(i) * time.Second))
+		// leaks 4KB every second, with an occasional free
+		leaking := series.Sample{AllocBytes: 4 << 10}
+		if i%5 == 4 {
+			leaking.FreeBytes = 2 << 10
+		}
+		coll.UpdateSample(index, 1, "", []uintptr{1}, leaking)
+		// frees everything it allocates
+		coll.UpdateSample(index, 1, "", []uintptr{2}, series.Sample{AllocBytes: 8 << 10, FreeBytes: 8 << 10})
+	}
+
+	leaks := series.NewLeakDetector(20).Detect(&coll.Collection, coll.List)
+	if len(leaks) != 1 {
+		t.Fatalf("got %d leaks, expected 1", len(leaks))
+	}
+	if leaks[0].Series.Stack[0] != 1 {
+		t.Errorf("got leak in %v", leaks[0].Series.Stack)
+	}
+	// 18KB every 5 seconds
+	if growth := leaks[0].Growth; growth < 180<<10 || growth > 260<<10 {
+		t.Errorf("got growth %.0f per minute", growth)
+	}
+}
@@ -0,0 +1,117 @@
+package series
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cycleBounds are the exclusive upper bounds of the GC cycle buckets.
+var cycleBounds = [...]int64{1, 2, 3, 5, 9, 17, 33}
+
+// ageBounds are the exclusive upper bounds of the age buckets.
+var ageBounds = [...]time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// Lifetime contains histograms of how long objects lived.
+type Lifetime struct {
+	// Count is the number of objects.
+	Count int64
+	// Cycles counts the objects by the number of GC cycles they survived.
+	Cycles [len(cycleBounds) + 1]int64
+	// Ages counts the objects by their age.
+	Ages [len(ageBounds) + 1]int64
+
+	MaxCycles int64
+	MaxAge    time.Duration
+}
+
+// Add adds an object that survived cycles GC cycles and lived for age.
+func (lifetime *Lifetime) Add(cycles int64, age time.Duration) {
+	lifetime.Count++
+
+	i := 0
+	for i < len(cycleBounds) && cycles >= cycleBounds[i] {
+		i++
+	}
+	lifetime.Cycles[i]++
+
+	i = 0
+	for i < len(ageBounds) && age >= ageBounds[i] {
+		i++
+	}
+	lifetime.Ages[i]++
+
+	if cycles > lifetime.MaxCycles {
+		lifetime.MaxCycles = cycles
+	}
+	if age > lifetime.MaxAge {
+		lifetime.MaxAge = age
+	}
+}
+
+// Merge adds the objects from b.
+func (lifetime *Lifetime) Merge(b *Lifetime) {
+	lifetime.Count += b.Count
+	for i, v := range b.Cycles {
+		lifetime.Cycles[i] += v
+	}
+	for i, v := range b.Ages {
+		lifetime.Ages[i] += v
+	}
+	if b.MaxCycles > lifetime.MaxCycles {
+		lifetime.MaxCycles = b.MaxCycles
+	}
+	if b.MaxAge > lifetime.MaxAge {
+		lifetime.MaxAge = b.MaxAge
+	}
+}
+
+// CyclesString formats the non-empty GC cycle buckets, e.g. "0: 120, 3-4: 5".
+func (lifetime *Lifetime) CyclesString() string {
+	var parts []string
+	for i, count := range lifetime.Cycles {
+		if count == 0 {
+			continue
+		}
+
+		var label string
+		switch {
+		case i == len(cycleBounds):
+			label = strconv.FormatInt(cycleBounds[i-1], 10) + "+"
+		case i == 0:
+			label = "0"
+		case cycleBounds[i]-1 == cycleBounds[i-1]:
+			label = strconv.FormatInt(cycleBounds[i-1], 10)
+		default:
+			label = strconv.FormatInt(cycleBounds[i-1], 10) + "-" + strconv.FormatInt(cycleBounds[i]-1, 10)
+		}
+		parts = append(parts, label+": "+strconv.FormatInt(count, 10))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AgesString formats the non-empty age buckets, e.g. "<1ms: 100, 1s+: 2".
+func (lifetime *Lifetime) AgesString() string {
+	var parts []string
+	for i, count := range lifetime.Ages {
+		if count == 0 {
+			continue
+		}
+
+		var label string
+		if i == len(ageBounds) {
+			label = ageBounds[i-1].String() + "+"
+		} else {
+			label = "<" + ageBounds[i].String()
+		}
+		parts = append(parts, label+": "+strconv.FormatInt(count, 10))
+	}
+	return strings.Join(parts, ", ")
+}
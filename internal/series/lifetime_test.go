@@ -0,0 +1,28 @@
+package series_test
+
+import (
+	"testing"
+	"time"
+
+	"loov.dev/allocview/internal/series"
+)
+
+func TestLifetime(t *testing.T) {
+	var a, b series.Lifetime
+	a.Add(0, 0)
+	a.Add(0, 5*time.Millisecond)
+	a.Add(2, 2*time.Second)
+	b.Add(4, time.Hour)
+	b.Add(100, 50*time.Millisecond)
+	a.Merge(&b)
+
+	if a.Count != 5 || a.MaxCycles != 100 || a.MaxAge != time.Hour {
+		t.Errorf("got count %d, max cycles %d, max age %v", a.Count, a.MaxCycles, a.MaxAge)
+	}
+	if got, expected := a.CyclesString(), "0: 2, 2: 1, 3-4: 1, 33+: 1"; got != expected {
+		t.Errorf("cycles: got %q, expected %q", got, expected)
+	}
+	if got, expected := a.AgesString(), "<1ms: 1, <10ms: 1, <100ms: 1, <10s: 1, 1m0s+: 1"; got != expected {
+		t.Errorf("ages: got %q, expected %q", got, expected)
+	}
+}
@@ -1,22 +1,55 @@
 package series
 
+// StackKey identifies a stack in a specific process.
+type StackKey struct {
+	Process int
+	Type    string
+	Stack   [32]uintptr
+}
+
 // Series is a ring-buffer indexed by Ring.
 type Series struct {
+	Process int
+	// Type is the allocated type, when it's known.
+	Type  string
 	Stack []uintptr
 
 	TotalAllocBytes   int64
 	TotalAllocObjects int64
 	Samples           []Sample
+
+	// Total is the cumulative sum of all samples.
+	Total Sample
+
+	// Sources are the full stack series merged into this series.
+	Sources []*Series
+	// group is the series that contains this full stack series.
+	group *Series
 }
 
 // SampleIndex indexes Samples slice in Series.
 type SampleIndex int
 
 func (series *Series) UpdateSample(index SampleIndex, sample Sample) {
+	series.addTotals(sample)
+	series.Samples[index].Add(sample)
+}
+
+// addTotals adds sample to the totals without updating the samples.
+func (series *Series) addTotals(sample Sample) {
 	series.TotalAllocBytes += sample.AllocBytes - sample.FreeBytes
 	series.TotalAllocObjects += sample.AllocObjects - sample.FreeObjects
+	series.Total.Add(sample)
+}
 
-	series.Samples[index].Add(sample)
+// Merge adds all samples from other series.
+func (series *Series) Merge(other *Series) {
+	series.TotalAllocBytes += other.TotalAllocBytes
+	series.TotalAllocObjects += other.TotalAllocObjects
+	series.Total.Add(other.Total)
+	for i := range series.Samples {
+		series.Samples[i].Add(other.Samples[i])
+	}
 }
 
 // Sample is total allocated or freed in SampleDuration.
@@ -60,3 +93,23 @@ func max(a, b int64) int64 {
 	}
 	return b
 }
+
+// Range returns the sum of samples in the range [from, to).
+//
+// head is the latest sample time, samples that are no longer
+// in the ring-buffer are ignored.
+func (series *Series) Range(head, from, to int) (r Sample) {
+	if oldest := head - len(series.Samples) + 1; from < oldest {
+		from = oldest
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to > head+1 {
+		to = head + 1
+	}
+	for p := from; p < to; p++ {
+		r.Add(series.Samples[p%len(series.Samples)])
+	}
+	return r
+}
@@ -0,0 +1,191 @@
+package series
+
+import "time"
+
+// MaxDepth is the maximum number of frames in a stack.
+const MaxDepth = 32
+
+// Grouping selects how the series are grouped.
+type Grouping byte
+
+const (
+	// GroupByStack groups series by the first Depth frames of the stack.
+	GroupByStack Grouping = iota
+	// GroupByType groups series by the allocated type.
+	GroupByType
+)
+
+// StackCollection implements sample aggregation based on the first Depth stack frames
+// or the allocated type.
+//
+// It additionally keeps a series for each full stack and type, which allows
+// to regroup the samples when Depth or Grouping changes. A group with a single
+// full stack shares the samples with it.
+type StackCollection struct {
+	Collection
+	Depth    int
+	Grouping Grouping
+
+	// Filter returns the frames of stack that are used for grouping,
+	// it may append to dst. When nil, all the frames are used.
+	Filter func(process int, stack, dst []uintptr) []uintptr
+
+	// ByStack is keyed by the first Depth frames of the stack or by the type.
+	ByStack map[StackKey]*Series
+
+	// Full contains a series for each full stack and type.
+	Full        []*Series
+	ByFullStack map[StackKey]*Series
+}
+
+// NewStackCollection returns a new StackCollection.
+func NewStackCollection(start time.Time, sampleDuration time.Duration, sampleCount int, depth int) *StackCollection {
+	return &StackCollection{
+		Collection:  *NewCollection(start, sampleDuration, sampleCount),
+		Depth:       clampDepth(depth),
+		ByStack:     make(map[StackKey]*Series),
+		ByFullStack: make(map[StackKey]*Series),
+	}
+}
+
+func clampDepth(depth int) int {
+	if depth < 1 {
+		return 1
+	}
+	if depth > MaxDepth {
+		return MaxDepth
+	}
+	return depth
+}
+
+// UpdateToTime updates StackCollection to the specified time and
+// returns the sample index corresponding to that time.
+func (coll *StackCollection) UpdateToTime(now time.Time) SampleIndex {
+	head := coll.SampleHead
+	index := coll.Collection.UpdateToTime(now)
+	clearSamples(coll.Full, head, coll.SampleHead)
+	return index
+}
+
+// UpdateSample updates the sample at specified index for the specific stack
+// and type, typ is empty when the type is not known.
+//
+// It returns the series of the full stack and type.
+func (coll *StackCollection) UpdateSample(index SampleIndex, process int, typ string, stack []uintptr, sample Sample) *Series {
+	full, isNew := coll.fullSeries(process, typ, stack)
+	if isNew {
+		addSource(coll.group(full), full)
+	}
+
+	full.UpdateSample(index, sample)
+	if group := full.group; len(group.Sources) > 1 {
+		group.UpdateSample(index, sample)
+	} else {
+		group.addTotals(sample)
+	}
+	return full
+}
+
+// SetDepth changes the number of frames used for grouping and regroups all series.
+func (coll *StackCollection) SetDepth(depth int) {
+	depth = clampDepth(depth)
+	if coll.Depth == depth {
+		return
+	}
+	coll.Depth = depth
+	coll.regroup()
+}
+
+// SetGrouping changes how the series are grouped and regroups all series.
+func (coll *StackCollection) SetGrouping(grouping Grouping) {
+	if coll.Grouping == grouping {
+		return
+	}
+	coll.Grouping = grouping
+	coll.regroup()
+}
+
+// regroup groups the full stack series again.
+func (coll *StackCollection) regroup() {
+	coll.List = nil
+	coll.ByStack = make(map[StackKey]*Series)
+	for _, full := range coll.Full {
+		addSource(coll.group(full), full)
+	}
+}
+
+// addSource adds the full stack series to group.
+//
+// The first source shares the samples with the group, the group
+// gets a copy of the samples when the second source is added.
+func addSource(group, full *Series) {
+	full.group = group
+	group.Sources = append(group.Sources, full)
+	switch len(group.Sources) {
+	case 1:
+		group.Samples = full.Samples
+		group.TotalAllocBytes = full.TotalAllocBytes
+		group.TotalAllocObjects = full.TotalAllocObjects
+		group.Total = full.Total
+	case 2:
+		group.Samples = append([]Sample(nil), group.Samples...)
+		group.Merge(full)
+	default:
+		group.Merge(full)
+	}
+}
+
+// fullSeries returns the series for the full stack and type.
+func (coll *StackCollection) fullSeries(process int, typ string, stack []uintptr) (*Series, bool) {
+	key := StackKey{Process: process, Type: typ}
+	n := copy(key.Stack[:], stack)
+	for n > 0 && key.Stack[n-1] == 0 {
+		n--
+	}
+
+	series, ok := coll.ByFullStack[key]
+	if ok {
+		return series, false
+	}
+
+	series = &Series{
+		Process: process,
+		Type:    typ,
+		Stack:   key.Stack[:n],
+		Samples: make([]Sample, coll.SampleCount),
+	}
+	coll.ByFullStack[key] = series
+	coll.Full = append(coll.Full, series)
+	return series, true
+}
+
+// group returns the series for the first Depth frames of the filtered
+// stack of full, or for the type when grouping by type.
+func (coll *StackCollection) group(full *Series) *Series {
+	key := StackKey{Process: full.Process}
+	depth := coll.Depth
+	stack := full.Stack
+	if coll.Grouping == GroupByType {
+		key.Type = full.Type
+		depth = 0
+	} else if coll.Filter != nil {
+		var filtered [MaxDepth]uintptr
+		stack = coll.Filter(full.Process, stack, filtered[:0])
+	}
+	if len(stack) > depth {
+		stack = stack[:depth]
+	}
+	n := copy(key.Stack[:], stack)
+
+	series, ok := coll.ByStack[key]
+	if !ok {
+		series = &Series{
+			Process: full.Process,
+			Type:    key.Type,
+			Stack:   key.Stack[:n],
+		}
+		coll.ByStack[key] = series
+		coll.List = append(coll.List, series)
+	}
+	return series
+}
@@ -0,0 +1,135 @@
+package series_test
+
+import (
+	"testing"
+	"time"
+
+	"loov.dev/allocview/internal/series"
+)
+
+func TestStackCollectionSetDepth(t *testing.T) {
+	start := time.Now()
+	coll := series.NewStackCollection(start, time.Second, 8, 1)
+
+	index := coll.UpdateToTime(start)
+	coll.UpdateSample(index, 1, "", []uintptr{1, 2, 3}, series.Sample{AllocBytes: 10})
+	coll.UpdateSample(index, 1, "", []uintptr{1, 4, 5}, series.Sample{AllocBytes: 20})
+	index = coll.UpdateToTime(start.Add(time.Second))
+	coll.UpdateSample(index, 1, "", []uintptr{1, 2, 3}, series.Sample{AllocBytes: 30})
+	coll.UpdateSample(index, 2, "", []uintptr{1, 2, 3}, series.Sample{AllocBytes: 40})
+
+	expect := func(depth int, totals ...int64) {
+		t.Helper()
+		coll.SetDepth(depth)
+		if len(coll.List) != len(totals) {
+			t.Fatalf("depth %d: got %d series, expected %d", depth, len(coll.List), len(totals))
+		}
+		for i, series := range coll.List {
+			if series.TotalAllocBytes != totals[i] {
+				t.Errorf("depth %d: series %d got %d, expected %d", depth, i, series.TotalAllocBytes, totals[i])
+			}
+			var sum int64
+			for _, sample := range series.Samples {
+				sum += sample.AllocBytes
+			}
+			if sum != totals[i] {
+				t.Errorf("depth %d: series %d samples sum to %d, expected %d", depth, i, sum, totals[i])
+			}
+		}
+	}
+
+	expect(1, 60, 40)
+	expect(2, 40, 20, 40)
+	expect(series.MaxDepth, 40, 20, 40)
+	expect(1, 60, 40)
+}
+
+func TestStackCollectionSetGrouping(t *testing.T) {
+	start := time.Now()
+	coll := series.NewStackCollection(start, time.Second, 8, 2)
+
+	index := coll.UpdateToTime(start)
+	coll.UpdateSample(index, 1, "T", []uintptr{1, 2, 3}, series.Sample{AllocBytes: 10})
+	coll.UpdateSample(index, 1, "U", []uintptr{1, 2, 3}, series.Sample{AllocBytes: 20})
+	coll.UpdateSample(index, 1, "T", []uintptr{1, 4, 5}, series.Sample{AllocBytes: 30})
+
+	expect := func(grouping series.Grouping, totals ...int64) {
+		t.Helper()
+		coll.SetGrouping(grouping)
+		if len(coll.List) != len(totals) {
+			t.Fatalf("grouping %d: got %d series, expected %d", grouping, len(coll.List), len(totals))
+		}
+		for i, series := range coll.List {
+			if series.TotalAllocBytes != totals[i] {
+				t.Errorf("grouping %d: series %d got %d, expected %d", grouping, i, series.TotalAllocBytes, totals[i])
+			}
+		}
+	}
+
+	expect(series.GroupByStack, 30, 30)
+	expect(series.GroupByType, 40, 20)
+	if typ := coll.List[0].Type; typ != "T" || len(coll.List[0].Sources) != 2 {
+		t.Errorf("got type %q with %d sources", typ, len(coll.List[0].Sources))
+	}
+
+	coll.SetDepth(series.MaxDepth)
+	expect(series.GroupByType, 40, 20)
+	expect(series.GroupByStack, 30, 30)
+}
+
+func TestStackCollectionFilter(t *testing.T) {
+	start := time.Now()
+	coll := series.NewStackCollection(start, time.Second, 8, series.MaxDepth)
+	// frames 8 and 9 are skipped when grouping
+	coll.Filter = func(process int, stack, dst []uintptr) []uintptr {
+		for _, frame := range stack {
+			if frame < 8 {
+				dst = append(dst, frame)
+			}
+		}
+		return dst
+	}
+
+	index := coll.UpdateToTime(start)
+	coll.UpdateSample(index, 1, "", []uintptr{9, 1, 2}, series.Sample{AllocBytes: 10})
+	coll.UpdateSample(index, 1, "", []uintptr{8, 1, 2}, series.Sample{AllocBytes: 20})
+
+	if len(coll.Full) != 2 || len(coll.Full[0].Stack) != 3 || coll.Full[0].Stack[0] != 9 {
+		t.Fatalf("full stacks were filtered: %v", coll.Full)
+	}
+	if len(coll.List) != 1 || coll.List[0].TotalAllocBytes != 30 || len(coll.List[0].Sources) != 2 {
+		t.Fatalf("got %d groups, expected a single group with both sources", len(coll.List))
+	}
+
+	coll.SetDepth(1)
+	if len(coll.List) != 1 || coll.List[0].Stack[0] != 1 {
+		t.Errorf("regrouping didn't use the filtered stack: %v", coll.List)
+	}
+}
+
+func TestStackCollectionSharedSamples(t *testing.T) {
+	start := time.Now()
+	coll := series.NewStackCollection(start, time.Second, 8, 1)
+
+	index := coll.UpdateToTime(start)
+	coll.UpdateSample(index, 1, "", []uintptr{1, 2}, series.Sample{AllocBytes: 10})
+	coll.UpdateSample(index, 1, "", []uintptr{1, 2}, series.Sample{AllocBytes: 5})
+
+	group, first := coll.List[0], coll.Full[0]
+	if group.Samples[index].AllocBytes != 15 || first.Samples[index].AllocBytes != 15 {
+		t.Fatalf("single source: got group %d and full %d, expected 15",
+			group.Samples[index].AllocBytes, first.Samples[index].AllocBytes)
+	}
+	if len(first.Sources) != 0 {
+		t.Errorf("full stack series has %d sources", len(first.Sources))
+	}
+
+	coll.UpdateSample(index, 1, "", []uintptr{1, 3}, series.Sample{AllocBytes: 20})
+	if group.Samples[index].AllocBytes != 35 || group.TotalAllocBytes != 35 {
+		t.Errorf("two sources: got group sample %d and total %d, expected 35",
+			group.Samples[index].AllocBytes, group.TotalAllocBytes)
+	}
+	if first.Samples[index].AllocBytes != 15 {
+		t.Errorf("two sources: first full stack got %d, expected 15", first.Samples[index].AllocBytes)
+	}
+}
@@ -15,7 +15,14 @@ type Binary struct {
 
 	SymTable *gosym.Table
 
-	Offset int64
+	frames map[uintptr]Frame
+}
+
+// Frame is a symbolized stack frame.
+type Frame struct {
+	Func string
+	File string
+	Line int
 }
 
 func Load(path string) (*Binary, error) {
@@ -28,16 +35,58 @@ func Load(path string) (*Binary, error) {
 		Data: data,
 
 		SymTable: symtab,
+
+		frames: map[uintptr]Frame{},
 	}, nil
 }
 
-func (bin *Binary) UpdateOffset(funcname string, funcaddr uintptr) {
-	// TODO: handle errors
+// NewBinary returns an empty Binary for frames that are
+// symbolized elsewhere, they are added with AddFrame.
+func NewBinary() *Binary {
+	return &Binary{
+		frames: map[uintptr]Frame{},
+	}
+}
+
+// AddFrame adds the symbolized frame for pc.
+func (bin *Binary) AddFrame(pc uintptr, frame Frame) {
+	bin.frames[pc] = frame
+}
+
+// Frame symbolizes a return address from a stack trace.
+//
+// The results are cached, hence Frame must not be called concurrently.
+func (bin *Binary) Frame(pc uintptr) (Frame, bool) {
+	if frame, ok := bin.frames[pc]; ok {
+		return frame, frame.File != ""
+	}
+	if bin.SymTable == nil {
+		return Frame{}, false
+	}
+
+	// pc is the return address, the call is at the previous instruction
+	file, line, fn := bin.SymTable.PCToLine(uint64(pc - 1))
+	frame := Frame{File: file, Line: line}
+	if fn != nil {
+		frame.Func = fn.Name
+	}
+	bin.frames[pc] = frame
+	return frame, frame.File != ""
+}
+
+// FuncOffset calculates the offset between the running process
+// and the binary based on the address of funcname.
+//
+// The offset differs for each process, when the binary is position independent.
+func (bin *Binary) FuncOffset(funcname string, funcaddr uintptr) (int64, bool) {
+	if bin.SymTable == nil {
+		return 0, false
+	}
 	sym := bin.SymTable.LookupFunc(funcname)
 	if sym == nil {
-		return
+		return 0, false
 	}
-	bin.Offset = int64(sym.Entry) - int64(funcaddr)
+	return int64(sym.Entry) - int64(funcaddr), true
 }
 
 func loadDwarfData(path string) (*dwarf.Data, *gosym.Table, error) {
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// objectLifetimes contains the lifetimes of the objects of a series.
+type objectLifetimes struct {
+	// Freed contains the lifetimes of the freed objects.
+	Freed series.Lifetime
+	// Unfreed contains the ages of the objects that were
+	// never freed, when the trace has ended.
+	Unfreed series.Lifetime
+}
+
+// addLifetimes adds the lifetimes of the i-th record of profile to full.
+func (summary *Summary) addLifetimes(profile *Profile, i int, full *series.Series) {
+	var freed, unfreed *series.Lifetime
+	if i < len(profile.Lifetimes) && profile.Lifetimes[i].Count > 0 {
+		freed = &profile.Lifetimes[i]
+	}
+	if i < len(profile.Unfreed) && profile.Unfreed[i].Count > 0 {
+		unfreed = &profile.Unfreed[i]
+	}
+	if freed == nil && unfreed == nil {
+		return
+	}
+
+	lifetimes, ok := summary.lifetimes[full]
+	if !ok {
+		lifetimes = &objectLifetimes{}
+		summary.lifetimes[full] = lifetimes
+	}
+	if freed != nil {
+		lifetimes.Freed.Merge(freed)
+	}
+	if unfreed != nil {
+		lifetimes.Unfreed.Merge(unfreed)
+	}
+}
+
+// Lifetimes returns the object lifetimes of all the full stacks of s.
+func (summary *Summary) Lifetimes(s *series.Series) (objectLifetimes, bool) {
+	var total objectLifetimes
+	found := false
+	for _, source := range s.Sources {
+		if lifetimes, ok := summary.lifetimes[source]; ok {
+			total.Freed.Merge(&lifetimes.Freed)
+			total.Unfreed.Merge(&lifetimes.Unfreed)
+			found = true
+		}
+	}
+	return total, found
+}
+
+// Unfreed returns the full stack series that have objects that were
+// never freed, sorted by the live bytes.
+func (summary *Summary) Unfreed() []*series.Series {
+	var list []*series.Series
+	for _, full := range summary.Collection.Full {
+		if lifetimes, ok := summary.lifetimes[full]; ok && lifetimes.Unfreed.Count > 0 {
+			list = append(list, full)
+		}
+	}
+	sort.SliceStable(list, func(i, k int) bool {
+		return list[i].TotalAllocBytes > list[k].TotalAllocBytes
+	})
+	return list
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"loov.dev/allocview/internal/prof"
+	"loov.dev/allocview/internal/protocol"
 )
 
 func init() {
@@ -30,13 +32,34 @@ func main() {
 
 This tool visualizes allocations of a Go program.
 
-Only programs that have imported "loov.dev/allocview/attach" are supported at the moment.
+Programs need to import "loov.dev/allocview/attach", other programs can be
+traced with GODEBUG=allocfreetrace=1, which is much slower.
 
 When given a subcommand, it executes that subcommand and starts live-visualization
 of the program. As an example:
 
     allocview go run ./testdata
 
+To record the session into a file, for looking at it later:
+
+    allocview record -o session.alv go run ./testdata
+    allocview replay -speed 2 session.alv
+
+To view a program running elsewhere, e.g. in a container, listen on a
+TCP address and start the program with ALLOCLOGADDR=tcp://host:port:
+
+    allocview listen -exe ./myservice :7070
+
+To trace a program that doesn't import the attach package, its standard
+error is consumed by the trace:
+
+    allocview trace ./myprogram
+
+Use -headless to collect allocations without opening a window, the top
+series are printed when the program exits:
+
+    allocview -headless -top 10 go run ./testdata
+
 Flags:
 `, os.Args[0])
 		flag.PrintDefaults()
@@ -50,6 +73,32 @@ Flags:
 
 	flag.DurationVar(&config.SampleDuration, "sample-duration", time.Second, "sample duration")
 	flag.IntVar(&config.SampleCount, "sample-count", 1024, "sample count")
+	flag.IntVar(&config.Depth, "depth", 3, "number of stack frames used for grouping (1..32), use [ and ] to change in the view")
+	flag.BoolVar(&config.Filter.Runtime, "skip-runtime", true, "skip runtime frames when grouping stacks")
+	flag.Var(&config.Filter.Patterns, "skip", "skip frames where the function matches `regexp` when grouping stacks, can be repeated")
+	flag.Var(&config.Group, "group", "group series by `mode`: stack or type, types are only known in trace mode, press G in the view to switch")
+	flag.Var(&config.Caption, "caption", "display frames as `func`, file or path, press F in the view to switch")
+	flag.Var(&config.Metric, "metric", "display and sort by `metric`: alloc-bytes, alloc-objects, live-bytes, live-objects or avg-size, press M in the view to switch")
+	flag.Var(&config.Sort, "sort", "sort series by `order`: metric, live, recent, peak, name or first-seen, press S in the view to switch")
+	flag.IntVar(&config.RecentSamples, "recent-samples", 10, "number of samples used for sorting by recent allocations")
+	flag.DurationVar(&config.LeakWindow, "leak-window", time.Minute, "flag series whose live bytes grow steadily over `duration`")
+	flag.StringVar(&config.PprofPath, "pprof", "", "export pprof profile to `file` at exit, press E in the view to export at any time")
+
+	var rate int
+	var interval time.Duration
+	var forceGC bool
+	var maxPacketSize int
+	flag.IntVar(&rate, "rate", 0, "sample an allocation every `bytes` on average in started programs, 0 uses the default of 1 which records every allocation")
+	flag.DurationVar(&interval, "interval", 0, "how often started programs send profiles, 0 uses the default of 100ms")
+	flag.BoolVar(&forceGC, "force-gc", false, "run a GC in started programs before each profile, which keeps the profile up to date but changes the GC behavior")
+	flag.IntVar(&maxPacketSize, "max-packet-size", protocol.MaxPacketSize, "maximum size of a profile packet in `bytes`, programs sending larger profiles are disconnected")
+
+	var headless bool
+	var report string
+	var top int
+	flag.BoolVar(&headless, "headless", false, "collect without opening a window and print a report at exit")
+	flag.StringVar(&report, "report", "", "write headless report to `file` instead of stdout")
+	flag.IntVar(&top, "top", 20, "number of series in the headless report")
 
 	flag.Parse()
 
@@ -60,19 +109,86 @@ Flags:
 
 	defer profcfg.Run()()
 
-	// Setup command that we want to monitor.
-	args := flag.Args()
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
 	var group errgroup.Group
 
 	server := NewServer()
-	err := server.Exec(ctx, &group, cmd)
-	if err != nil {
-		log.Fatal(err)
+	server.Rate = rate
+	server.Interval = interval
+	server.ForceGC = forceGC
+	server.MaxPacketSize = maxPacketSize
+	defer func() {
+		if err := server.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	args := flag.Args()
+	switch args[0] {
+	case "record":
+		flags := flag.NewFlagSet("record", flag.ExitOnError)
+		output := flags.String("o", "session.alv", "write session to `file`")
+		_ = flags.Parse(args[1:])
+		if flags.NArg() == 0 {
+			flags.Usage()
+			os.Exit(2)
+		}
+
+		err := server.Record(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = server.Exec(ctx, &group, command(flags.Args()))
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "listen":
+		flags := flag.NewFlagSet("listen", flag.ExitOnError)
+		exename := flags.String("exe", "", "load symbols from `binary` instead of the path sent by the client")
+		_ = flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+
+		err := server.Listen(ctx, &group, flags.Arg(0), *exename)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "trace":
+		if len(args) < 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		err := server.Trace(ctx, &group, command(args[1:]))
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "replay":
+		flags := flag.NewFlagSet("replay", flag.ExitOnError)
+		speed := flags.Float64("speed", 1, "replay speed multiplier")
+		exename := flags.String("exe", "", "load symbols from `binary` instead of the recorded path")
+		_ = flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+
+		err := server.Replay(ctx, &group, flags.Arg(0), *exename, *speed)
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		err := server.Exec(ctx, &group, command(args))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if headless {
+		runHeadless(ctx, &group, config, server, report, top)
+		return
 	}
 
 	group.Go(func() error {
@@ -86,8 +202,55 @@ Flags:
 
 	app.Main()
 
-	err = group.Wait()
+	err := group.Wait()
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// runHeadless collects profiles until the program exits or is interrupted
+// and then writes the report.
+func runHeadless(ctx context.Context, group *errgroup.Group, config Config, server *Server, report string, top int) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	done := make(chan error, 1)
+	go func() { done <- group.Wait() }()
+
+	headless := NewHeadless(config, server)
+	headless.Top = top
+	err := headless.Run(ctx, done)
 	if err != nil {
 		log.Println(err)
 	}
+
+	out := os.Stdout
+	if report != "" {
+		out, err = os.Create(report)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+	}
+
+	err = headless.WriteReport(out)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if config.PprofPath != "" {
+		err = headless.Summary.ExportPprof(config.PprofPath)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// command creates the command that we want to monitor.
+func command(args []string) *exec.Cmd {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// Metric defines which values are displayed and used for sorting.
+type Metric int
+
+const (
+	// MetricAllocBytes displays allocated and freed bytes.
+	MetricAllocBytes Metric = iota
+	// MetricAllocObjects displays allocated and freed objects.
+	MetricAllocObjects
+	// MetricLiveBytes displays bytes in use.
+	MetricLiveBytes
+	// MetricLiveObjects displays objects in use.
+	MetricLiveObjects
+	// MetricAverageSize displays the average size of allocated objects.
+	MetricAverageSize
+
+	metricCount
+)
+
+func (metric Metric) String() string {
+	switch metric {
+	case MetricAllocBytes:
+		return "alloc-bytes"
+	case MetricAllocObjects:
+		return "alloc-objects"
+	case MetricLiveBytes:
+		return "live-bytes"
+	case MetricLiveObjects:
+		return "live-objects"
+	case MetricAverageSize:
+		return "avg-size"
+	default:
+		return "invalid"
+	}
+}
+
+// Set implements flag.Value.
+func (metric *Metric) Set(value string) error {
+	for m := Metric(0); m < metricCount; m++ {
+		if m.String() == value {
+			*metric = m
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown metric %q, expected alloc-bytes, alloc-objects, live-bytes, live-objects or avg-size", value)
+}
+
+// Next returns the next metric for cycling.
+func (metric Metric) Next() Metric {
+	return (metric + 1) % metricCount
+}
+
+// Value returns the total of s used for sorting.
+func (metric Metric) Value(s *series.Series) int64 {
+	switch metric {
+	case MetricAllocBytes:
+		return s.Total.AllocBytes
+	case MetricAllocObjects:
+		return s.Total.AllocObjects
+	case MetricLiveBytes:
+		return s.TotalAllocBytes
+	case MetricLiveObjects:
+		return s.TotalAllocObjects
+	case MetricAverageSize:
+		return averageSize(s.Total.AllocBytes, s.Total.AllocObjects)
+	default:
+		return 0
+	}
+}
+
+// Format formats the value of the metric.
+func (metric Metric) Format(value int64) string {
+	switch metric {
+	case MetricAllocObjects, MetricLiveObjects:
+		return strconv.FormatInt(value, 10) + " objects"
+	default:
+		return SizeToString(value)
+	}
+}
+
+// Caption describes the total of s.
+func (metric Metric) Caption(s *series.Series) string {
+	value := metric.Format(metric.Value(s))
+	switch metric {
+	case MetricAllocBytes, MetricAllocObjects:
+		return value + " allocated"
+	case MetricLiveBytes, MetricLiveObjects:
+		return value + " live"
+	case MetricAverageSize:
+		return value + " average"
+	default:
+		return value
+	}
+}
+
+// Bars returns the displayed values for bins. Metrics with a counterpart,
+// such as freed bytes for allocated bytes, also return opposite values,
+// which are displayed on the other side of the axis.
+//
+// after is the sum of samples following the last bin, which is needed
+// for calculating the values in use.
+func (metric Metric) Bars(s *series.Series, bins []series.Sample, after series.Sample) (values, opposite []int64) {
+	values = make([]int64, len(bins))
+	switch metric {
+	case MetricAllocBytes, MetricAllocObjects:
+		opposite = make([]int64, len(bins))
+		for i, bin := range bins {
+			if metric == MetricAllocBytes {
+				values[i], opposite[i] = bin.AllocBytes, bin.FreeBytes
+			} else {
+				values[i], opposite[i] = bin.AllocObjects, bin.FreeObjects
+			}
+		}
+	case MetricLiveBytes, MetricLiveObjects:
+		// walk backwards from the current total
+		live := s.TotalAllocBytes - (after.AllocBytes - after.FreeBytes)
+		if metric == MetricLiveObjects {
+			live = s.TotalAllocObjects - (after.AllocObjects - after.FreeObjects)
+		}
+		for i := len(bins) - 1; i >= 0; i-- {
+			values[i] = live
+			if metric == MetricLiveBytes {
+				live -= bins[i].AllocBytes - bins[i].FreeBytes
+			} else {
+				live -= bins[i].AllocObjects - bins[i].FreeObjects
+			}
+		}
+	case MetricAverageSize:
+		for i, bin := range bins {
+			values[i] = averageSize(bin.AllocBytes, bin.AllocObjects)
+		}
+	}
+	return values, opposite
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"loov.dev/allocview/internal/packet"
+	"loov.dev/allocview/internal/protocol"
+)
+
+// SessionMagic is the header of a recorded session file.
+const SessionMagic = "allocview-session"
+
+// SessionVersion is the current version of the session file format.
+const SessionVersion = 1
+
+// Recording writes everything received from clients into a session file.
+//
+// The session file starts with a header packet, which is followed by
+// a packet for each received packet. Each of them contains the process ID
+// and the packet exactly as it was received from the client. The first
+// packet of each process is the handshake.
+type Recording struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  packet.Encoder
+}
+
+// CreateRecording creates a new session file.
+func CreateRecording(path string) (*Recording, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create session file: %w", err)
+	}
+
+	rec := &Recording{
+		file: file,
+		enc:  packet.NewEncoder(1 << 20),
+	}
+
+	enc := packet.NewEncoder(64)
+	enc.String(SessionMagic)
+	enc.Uint32(SessionVersion)
+	if _, err := file.Write(enc.LengthAndBytes()); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("unable to write session header: %w", err)
+	}
+
+	return rec, nil
+}
+
+// WritePacket writes a packet received from process to the session file.
+//
+// The data is not buffered, because app.Main may exit the process
+// without giving us a chance to flush.
+func (rec *Recording) WritePacket(processID int, data []byte) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.enc.Reset()
+	rec.enc.Uint32(uint32(processID))
+	rec.enc.Bytes(data)
+	_, err := rec.file.Write(rec.enc.LengthAndBytes())
+	return err
+}
+
+// Close closes the session file.
+func (rec *Recording) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.file.Close()
+}
+
+// Record starts recording all received data into a session file at path.
+func (server *Server) Record(path string) error {
+	rec, err := CreateRecording(path)
+	if err != nil {
+		return err
+	}
+	server.recording = rec
+	return nil
+}
+
+// Close stops recording.
+func (server *Server) Close() error {
+	if server.recording == nil {
+		return nil
+	}
+	return server.recording.Close()
+}
+
+// Replay starts reading profiles from a session file at path.
+//
+// Profiles are delivered at the original pace multiplied by speed.
+// When exename is not empty, it's used instead of the recorded executable
+// name for loading symbols.
+func (server *Server) Replay(ctx context.Context, group *errgroup.Group, path string, exename string, speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("invalid replay speed %v", speed)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open session file: %w", err)
+	}
+	r := bufio.NewReader(file)
+
+	dec := packet.Decoder{MaxSize: protocol.MaxHandshakeSize}
+	if err := dec.Read(r); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to read session header: %w", err)
+	}
+	if magic := dec.String(); magic != SessionMagic {
+		_ = file.Close()
+		return fmt.Errorf("%q is not a session file", path)
+	}
+	if version := dec.Uint32(); version != SessionVersion {
+		_ = file.Close()
+		return fmt.Errorf("unsupported session version %d expected %d", version, SessionVersion)
+	}
+
+	group.Go(func() error {
+		defer file.Close()
+		err := server.replayProfiles(ctx, r, exename, speed)
+		log.Printf("replay finished: %v", err)
+		return err
+	})
+
+	return nil
+}
+
+func (server *Server) replayProfiles(ctx context.Context, r io.Reader, exename string, speed float64) error {
+	clients := map[uint32]*client{}
+
+	var first, last time.Time
+	start := time.Now()
+
+	// frames contain the process id in addition to the packet
+	frame := packet.Decoder{MaxSize: server.MaxPacketSize + 8}
+	var dec packet.Decoder
+	for {
+		err := frame.Read(r)
+		if err != nil {
+			// the recording may have been cut short mid-packet
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+
+		recordedID := frame.Uint32()
+		dec.Reset(frame.Bytes())
+		if err := frame.Err(); err != nil {
+			return fmt.Errorf("invalid session frame: %w", err)
+		}
+
+		client, ok := clients[recordedID]
+		if !ok {
+			process, err := decodeProcess(&dec)
+			if err != nil {
+				return err
+			}
+			process.ID = server.nextProcessID()
+			if exename != "" {
+				process.ExeName = exename
+			}
+			clients[recordedID] = newClient(process)
+			continue
+		}
+
+		profile, err := client.decode(&dec)
+		if err != nil {
+			return fmt.Errorf("invalid recorded packet: %w", err)
+		}
+
+		// rebase the profile time relative to the replay start,
+		// so that the collections see a monotonic clock
+		if first.IsZero() {
+			first = profile.Time
+		}
+		elapsed := time.Duration(float64(profile.Time.Sub(first)) / speed)
+		profile.Time = start.Add(elapsed)
+		for i := range profile.GCs {
+			profile.GCs[i].Ago = time.Duration(float64(profile.GCs[i].Ago) / speed)
+		}
+		if profile.Time.Before(last) {
+			profile.Time = last
+		}
+		last = profile.Time
+
+		select {
+		case <-time.After(time.Until(profile.Time)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		server.profiles <- profile
+	}
+}
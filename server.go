@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"loov.dev/allocview/internal/packet"
+	"loov.dev/allocview/internal/protocol"
 	"loov.dev/allocview/internal/series"
+	"loov.dev/allocview/internal/symbols"
 )
 
 // ConnectDeadline defines how fast clients should connect to the server.
@@ -22,12 +28,32 @@ const ConnectDeadline = 10 * time.Second
 
 // Server is a profile listening server.
 type Server struct {
+	// Rate is the MemProfileRate passed to started programs,
+	// 0 uses the default of the program.
+	Rate int
+	// Interval is how often started programs send profiles,
+	// 0 uses the default of the program.
+	Interval time.Duration
+	// ForceGC makes started programs run a GC before each profile,
+	// which keeps the profile up to date at the cost of changing the
+	// GC behavior of the program.
+	ForceGC bool
+	// MaxPacketSize is the maximum size of a profile packet,
+	// programs sending larger profiles are disconnected.
+	MaxPacketSize int
+
 	profiles chan *Profile
+
+	recording *Recording
+
+	lastProcessID int32
 }
 
 // NewServer returns a new server.
 func NewServer() *Server {
 	return &Server{
+		MaxPacketSize: protocol.MaxPacketSize,
+
 		profiles: make(chan *Profile, 1024),
 	}
 }
@@ -36,6 +62,8 @@ func NewServer() *Server {
 func (server *Server) Profiles() <-chan *Profile { return server.profiles }
 
 // Exec starts listening to cmd.
+//
+// All processes started by cmd that connect to the server are monitored.
 func (server *Server) Exec(ctx context.Context, group *errgroup.Group, cmd *exec.Cmd) error {
 	// create a temporary socket name
 	tmpfile, err := ioutil.TempFile("", "alloclog")
@@ -59,6 +87,15 @@ func (server *Server) Exec(ctx context.Context, group *errgroup.Group, cmd *exec
 		os.Environ(),
 		"ALLOCLOGSOCK="+sockname,
 	)
+	if server.Rate > 0 {
+		cmd.Env = append(cmd.Env, "ALLOCLOGRATE="+strconv.Itoa(server.Rate))
+	}
+	if server.Interval > 0 {
+		cmd.Env = append(cmd.Env, "ALLOCLOGINTERVAL="+server.Interval.String())
+	}
+	if server.ForceGC {
+		cmd.Env = append(cmd.Env, "ALLOCLOGFORCEGC=1")
+	}
 	err = cmd.Start() // TODO: use pgroup
 	if err != nil {
 		return fmt.Errorf("failed to start %q: %w", cmd.Args, err)
@@ -79,114 +116,356 @@ func (server *Server) Exec(ctx context.Context, group *errgroup.Group, cmd *exec
 		return fmt.Errorf("no connection established, did you import `loov.dev/allocview/attach`: %w", err)
 	}
 
-	// we'll set deadline for the first packet to handle misconfigurations
-	err = conn.SetReadDeadline(time.Now().Add(ConnectDeadline))
+	client, err := server.handshake(conn, "")
 	if err != nil {
 		_ = cmd.Process.Kill()
 		_ = sock.Close()
-		return fmt.Errorf("failed to set read deadline: %w", err)
-	}
-	var dec packet.Decoder
-	err = dec.Read(conn)
-	if err != nil {
-		return fmt.Errorf("failed to read first packet: %w", err)
+		return err
 	}
-	err = conn.SetReadDeadline(time.Time{})
+
+	err = sock.SetDeadline(time.Time{})
 	if err != nil {
 		_ = cmd.Process.Kill()
 		_ = sock.Close()
-		return fmt.Errorf("failed to set read deadline: %w", err)
-	}
-
-	// TODO: handle magic header better
-	magic := dec.String()
-	if magic != "alloclog" {
-		return fmt.Errorf("invalid header %q expected %q", magic, "alloclog")
+		return fmt.Errorf("failed to clear socket deadline: %w", err)
 	}
 
-	exename := dec.String()
-	funcname := dec.String()
-	funcaddr := dec.Uintptr()
-
 	// Reading of profiles.
 	group.Go(func() error {
-		err := server.readProfiles(conn, exename, funcname, funcaddr)
-		log.Printf("readProfiles returned: %v", err)
-		return err
+		return server.readProfiles(conn, client)
+	})
+
+	// Other processes started by the program.
+	group.Go(func() error {
+		server.acceptAll(group, sock, "")
+		return nil
 	})
 
 	group.Go(func() error {
 		// waits for program to close
 		err := cmd.Wait()
 		log.Printf("program exited: %v", err)
+		_ = sock.Close()
 		return err
 	})
 
 	return nil
 }
 
-func (server *Server) readProfiles(conn *net.UnixConn, exename, funcname string, funcaddr uintptr) error {
-	lastState := map[[32]uintptr]series.Sample{}
+// Listen starts listening for clients on the specified address,
+// until ctx is done.
+//
+// The address is either "tcp://host:port", "unix:///path/to/socket"
+// or "host:port". When exename is not empty, it's used instead of
+// the executable path sent by the client for loading symbols.
+func (server *Server) Listen(ctx context.Context, group *errgroup.Group, address string, exename string) error {
+	network, address := protocol.ParseAddr(address)
 
-	var dec packet.Decoder
+	sock, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s %q: %w", network, address, err)
+	}
+	log.Printf("listening on %s://%s", network, sock.Addr())
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = sock.Close()
+		case <-stopped:
+		}
+	}()
+
+	group.Go(func() error {
+		defer close(stopped)
+		server.acceptAll(group, sock, exename)
+		return nil
+	})
+
+	return nil
+}
+
+// acceptAll accepts connections until the listener is closed.
+func (server *Server) acceptAll(group *errgroup.Group, sock net.Listener, exename string) {
 	for {
-		err := dec.Read(conn)
+		conn, err := sock.Accept()
 		if err != nil {
-			return fmt.Errorf("failed to read packet: %w", err)
+			return
 		}
 
-		unixnano := dec.Int64()
-		count := dec.Uint32()
-
-		profile := &Profile{
-			ExeName: exename,
+		group.Go(func() error {
+			client, err := server.handshake(conn, exename)
+			if err != nil {
+				log.Printf("rejected connection from %q: %v", conn.RemoteAddr(), err)
+				_ = conn.Close()
+				return nil
+			}
+			return server.readProfiles(conn, client)
+		})
+	}
+}
 
-			FuncName: funcname,
-			FuncAddr: funcaddr,
+// handshake reads the handshake from a newly established connection.
+func (server *Server) handshake(conn net.Conn, exename string) (*client, error) {
+	// we'll set deadline for the first packet to handle misconfigurations
+	err := conn.SetDeadline(time.Now().Add(ConnectDeadline))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
 
-			Time: time.Unix(0, unixnano),
+	dec := packet.Decoder{MaxSize: protocol.MaxHandshakeSize}
+	err = dec.Read(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read first packet: %w", err)
+	}
 
-			Records: make([]runtime.MemProfileRecord, count),
+	process, err := decodeProcess(&dec)
+	if !errors.Is(err, errNotAgent) {
+		// agents need to know why they were rejected
+		if replyErr := writeReply(conn, process, err); replyErr != nil && err == nil {
+			err = fmt.Errorf("failed to reply: %w", replyErr)
 		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		for i, rec := range profile.Records {
-			var next series.Sample
-			next.AllocBytes = dec.Int64()
-			next.FreeBytes = dec.Int64()
-			next.AllocObjects = dec.Int64()
-			next.FreeObjects = dec.Int64()
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
 
-			for i := 0; ; i++ {
-				frame := dec.Uintptr()
-				if frame == 0 {
-					break
-				}
+	process.ID = server.nextProcessID()
+	if exename != "" {
+		process.ExeName = exename
+	}
+	log.Printf("process %d connected: pid %d %q, features %v", process.ID, process.PID, process.ExeName, process.Features)
 
-				rec.Stack0[i] = frame
-			}
+	server.record(process.ID, dec.Data())
+	return newClient(process), nil
+}
+
+// writeReply replies to the hello packet of the agent,
+// rejecting the agent when err is not nil.
+func writeReply(conn net.Conn, process *Process, err error) error {
+	enc := packet.NewEncoder(256)
+	enc.String(protocol.ViewerMagic)
+	enc.Uint32(protocol.Version)
+	if err != nil {
+		enc.Uint32(0)
+		enc.String(err.Error())
+	} else {
+		enc.Uint32(uint32(process.Features))
+		enc.String("")
+	}
+
+	_, werr := conn.Write(enc.LengthAndBytes())
+	return werr
+}
+
+func (server *Server) nextProcessID() int {
+	return int(atomic.AddInt32(&server.lastProcessID, 1))
+}
+
+func (server *Server) record(processID int, data []byte) {
+	if server.recording == nil {
+		return
+	}
+	err := server.recording.WritePacket(processID, data)
+	if err != nil {
+		log.Printf("failed to record: %v", err)
+	}
+}
 
-			last, _ := lastState[rec.Stack0]
-			lastState[rec.Stack0] = next
+func (server *Server) readProfiles(conn net.Conn, client *client) error {
+	defer conn.Close()
 
-			rec.AllocBytes = next.AllocBytes - last.AllocBytes
-			rec.FreeBytes = next.FreeBytes - last.FreeBytes
-			rec.AllocObjects = next.AllocObjects - last.AllocObjects
-			rec.FreeObjects = next.FreeObjects - last.FreeObjects
+	dec := packet.Decoder{MaxSize: server.MaxPacketSize}
+	for {
+		err := dec.Read(conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				log.Printf("process %d disconnected", client.process.ID)
+				return nil
+			}
+			return fmt.Errorf("process %d: failed to read packet: %w", client.process.ID, err)
+		}
 
-			profile.Records[i] = rec
+		profile, err := client.decode(&dec)
+		if err != nil {
+			return fmt.Errorf("process %d: invalid packet: %w", client.process.ID, err)
 		}
 
+		server.record(client.process.ID, dec.Data())
 		server.profiles <- profile
 	}
 }
 
-type Profile struct {
+// Process identifies a connected program.
+type Process struct {
+	// ID is assigned by the server and is unique for each connection.
+	ID  int
+	PID int
+
 	ExeName string
 
 	FuncName string
 	FuncAddr uintptr
 
+	// Rate is the MemProfileRate of the process, the agent
+	// scales the sampled counts before sending them.
+	Rate int
+	// Features are the enabled protocol features.
+	Features protocol.Features
+
+	// Traced is set for processes started with allocfreetrace,
+	// their frames are symbolized from the trace and
+	// sent with the profiles.
+	Traced bool
+}
+
+// errNotAgent is returned when the client is not an allocview agent.
+var errNotAgent = errors.New("not an allocview agent")
+
+// decodeProcess decodes the hello packet sent by the agent.
+func decodeProcess(dec *packet.Decoder) (*Process, error) {
+	magic := dec.String()
+	switch {
+	case magic == protocol.LegacyMagic:
+		return nil, errors.New("agent uses an unversioned protocol, rebuild the program with the same version of loov.dev/allocview/attach as the viewer")
+	case dec.Err() != nil || magic != protocol.AgentMagic:
+		return nil, errNotAgent
+	}
+
+	version := dec.Uint32()
+	if version != protocol.Version {
+		return nil, fmt.Errorf("agent uses protocol version %d, but the viewer supports version %d, use the same version of loov.dev/allocview/attach as the viewer", version, protocol.Version)
+	}
+
+	process := &Process{}
+	// enable all the features that both sides support
+	process.Features = protocol.Features(dec.Uint32()) & protocol.Supported
+	process.ExeName = dec.String()
+	process.FuncName = dec.String()
+	process.FuncAddr = dec.Uintptr()
+	process.PID = int(dec.Uint32())
+	process.Rate = int(dec.Uint32())
+
+	if err := dec.Err(); err != nil {
+		return nil, fmt.Errorf("invalid hello packet: %w", err)
+	}
+	return process, nil
+}
+
+// client decodes profiles sent by a single process.
+type client struct {
+	process *Process
+	records protocol.RecordDecoder
+}
+
+func newClient(process *Process) *client {
+	return &client{process: process}
+}
+
+// decode decodes a profile packet.
+//
+// The process sends each stack once and afterwards only
+// the changes of the counters for the stacks.
+func (client *client) decode(dec *packet.Decoder) (*Profile, error) {
+	unixnano := dec.Int64()
+	numGC := dec.Uint32()
+
+	profile := &Profile{
+		Process: client.process,
+
+		Time:  time.Unix(0, unixnano),
+		NumGC: numGC,
+	}
+
+	records, err := client.records.Decode(dec)
+	if err != nil {
+		return nil, err
+	}
+	profile.Records = records
+
+	if client.process.Features.Has(protocol.FeatureMetrics) {
+		metrics := int(dec.Uint32())
+		profile.Metrics = make(map[string]float64)
+		for i := 0; i < metrics && dec.Err() == nil; i++ {
+			name := dec.String()
+			profile.Metrics[name] = dec.Float64()
+		}
+
+		profile.MemStats.HeapInuse = dec.Uint64()
+		profile.MemStats.NextGC = dec.Uint64()
+		profile.MemStats.PauseTotalNs = dec.Uint64()
+		profile.MemStats.GCCPUFraction = dec.Float64()
+	}
+
+	if client.process.Features.Has(protocol.FeatureGCs) {
+		gcs := int(dec.Uint32())
+		for i := 0; i < gcs && dec.Err() == nil; i++ {
+			var gc GC
+			gc.Cycle = dec.Uint32()
+			gc.Ago = time.Duration(dec.Int64())
+			gc.Pause = time.Duration(dec.Uint64())
+			profile.GCs = append(profile.GCs, gc)
+		}
+	}
+
+	if err := dec.Err(); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+type Profile struct {
+	Process *Process
+
 	Time time.Time
+	// NumGC is the number of completed GC cycles, Records
+	// contain allocations up to the end of the last cycle.
+	NumGC uint32
 
 	Records []runtime.MemProfileRecord
+	// Types contains the allocated type for each of the records,
+	// when the process is traced.
+	Types []string
+	// Lifetimes contains the lifetimes of the objects freed since
+	// the previous profile for each of the records, when the process
+	// is traced.
+	Lifetimes []series.Lifetime
+	// Unfreed contains the ages of the objects that were never freed
+	// for each of the records, it's only set in the last profile of
+	// a traced process.
+	Unfreed []series.Lifetime
+	// Frames contains the symbolized frames first used in this profile,
+	// when the process is traced.
+	Frames map[uintptr]symbols.Frame
+
+	// Metrics contains values from runtime/metrics.
+	Metrics map[string]float64
+	// MemStats contains values from runtime.MemStats.
+	MemStats MemStats
+	// GCs contains the GC cycles completed since the previous profile.
+	GCs []GC
+}
+
+// GC describes a completed GC cycle.
+type GC struct {
+	// Cycle is the number of the cycle, starting from 1.
+	Cycle uint32
+	// Ago is how long before the profile time the cycle completed.
+	Ago time.Duration
+	// Pause is the total stop-the-world pause of the cycle.
+	Pause time.Duration
+}
+
+// MemStats contains a subset of runtime.MemStats.
+type MemStats struct {
+	HeapInuse     uint64
+	NextGC        uint64
+	PauseTotalNs  uint64
+	GCCPUFraction float64
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// SortOrder defines how series are ordered.
+type SortOrder int
+
+const (
+	// SortMetric sorts by the total of the selected metric.
+	SortMetric SortOrder = iota
+	// SortLive sorts by live bytes.
+	SortLive
+	// SortRecent sorts by bytes allocated in the recent samples.
+	SortRecent
+	// SortPeak sorts by the largest allocated bytes in a single sample.
+	SortPeak
+	// SortName sorts alphabetically by the stack.
+	SortName
+	// SortFirstSeen sorts by the time the series was first seen.
+	SortFirstSeen
+
+	sortOrderCount
+)
+
+func (order SortOrder) String() string {
+	switch order {
+	case SortMetric:
+		return "metric"
+	case SortLive:
+		return "live"
+	case SortRecent:
+		return "recent"
+	case SortPeak:
+		return "peak"
+	case SortName:
+		return "name"
+	case SortFirstSeen:
+		return "first-seen"
+	default:
+		return "invalid"
+	}
+}
+
+// Set implements flag.Value.
+func (order *SortOrder) Set(value string) error {
+	for o := SortOrder(0); o < sortOrderCount; o++ {
+		if o.String() == value {
+			*order = o
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sort order %q, expected metric, live, recent, peak, name or first-seen", value)
+}
+
+// Next returns the next order for cycling.
+func (order SortOrder) Next() SortOrder {
+	return (order + 1) % sortOrderCount
+}
+
+// Sort sorts list according to Config.Sort.
+//
+// The series in list must be in the order they were first seen.
+func (summary *Summary) Sort(list []*series.Series) {
+	collection := summary.Collection
+
+	switch summary.Config.Sort {
+	case SortMetric:
+		metric := summary.Config.Metric
+		sortByValue(list, metric.Value)
+	case SortLive:
+		sortByValue(list, func(s *series.Series) int64 {
+			return s.TotalAllocBytes
+		})
+	case SortRecent:
+		head := collection.SampleHead
+		from := head - summary.Config.RecentSamples + 1
+		sortByValue(list, func(s *series.Series) int64 {
+			return s.Range(head, from, head+1).AllocBytes
+		})
+	case SortPeak:
+		sortByValue(list, func(s *series.Series) int64 {
+			return s.Max().AllocBytes
+		})
+	case SortName:
+		names := make(map[*series.Series]string, len(list))
+		for _, s := range list {
+			names[s] = summary.SeriesName(s)
+		}
+		sort.SliceStable(list, func(i, k int) bool {
+			return names[list[i]] < names[list[k]]
+		})
+	case SortFirstSeen:
+		// list is already in the right order
+	}
+}
+
+// sortByValue sorts list by descending value, computing each value once.
+func sortByValue(list []*series.Series, value func(*series.Series) int64) {
+	values := make(map[*series.Series]int64, len(list))
+	for _, s := range list {
+		values[s] = value(s)
+	}
+	sort.SliceStable(list, func(i, k int) bool {
+		return values[list[i]] > values[list[k]]
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"path/filepath"
 	"time"
 
 	"loov.dev/allocview/internal/series"
@@ -13,67 +14,272 @@ import (
 type Summary struct {
 	Config Config
 
-	Symbols    *symbols.Binary
-	Collection *series.Collection3
+	// Processes contains all processes in the order they were first seen.
+	Processes []*Process
+	// Binaries contains symbols for each loaded executable.
+	Binaries map[string]*symbols.Binary
+
+	symbols map[int]*processSymbols
+	// cycles contains the number of completed GC cycles for each process.
+	cycles map[int]uint32
+	// gauges contains runtime metrics for each process.
+	gauges map[int]map[string]*series.Gauge
+	// GCs contains the GC cycles that are in the ring-buffer.
+	GCs []GCEvent
+	// lifetimes contains the lifetimes of objects for each full stack
+	// series of traced processes.
+	lifetimes map[*series.Series]*objectLifetimes
+
+	Collection *series.StackCollection
+
+	// LeakDetector flags series with steadily growing live bytes.
+	LeakDetector *series.LeakDetector
+	leaks        leakCache
+}
+
+// leakCache contains detected leaks for a specific sample and depth.
+type leakCache struct {
+	valid    bool
+	head     int
+	depth    int
+	grouping series.Grouping
+
+	list     []series.Leak
+	bySeries map[*series.Series]series.Leak
+}
+
+// processSymbols contains symbols for a specific process.
+type processSymbols struct {
+	binary *symbols.Binary
+	offset int64
+
+	// skip caches FrameFilter results for each frame.
+	skip map[uintptr]bool
 }
 
 func NewSummary(config Config) *Summary {
-	return &Summary{
-		Config:     config,
-		Collection: series.NewCollection3(time.Now(), config.SampleDuration, config.SampleCount),
+	summary := &Summary{
+		Config:       config,
+		Binaries:     map[string]*symbols.Binary{},
+		symbols:      map[int]*processSymbols{},
+		cycles:       map[int]uint32{},
+		gauges:       map[int]map[string]*series.Gauge{},
+		lifetimes:    map[*series.Series]*objectLifetimes{},
+		Collection:   series.NewStackCollection(time.Now(), config.SampleDuration, config.SampleCount, config.Depth),
+		LeakDetector: series.NewLeakDetector(int(config.LeakWindow / config.SampleDuration)),
 	}
+	summary.Collection.Filter = summary.groupStack
+	summary.Collection.SetGrouping(config.Group.Grouping())
+	return summary
 }
 
 // Add adds profile to the collections.
 func (summary *Summary) Add(profile *Profile) {
-	// TODO: per binary symbols
-	if summary.Symbols == nil {
-		// TODO: is there a better location to do this?
-		var err error
-		summary.Symbols, err = symbols.Load(profile.ExeName)
-		if err != nil {
-			log.Fatal(err)
-		}
+	syms := summary.processSymbols(profile.Process)
 
-		summary.Symbols.UpdateOffset(profile.FuncName, profile.FuncAddr)
+	collection := summary.Collection
+	// profiles from different processes may arrive slightly out of order
+	if profile.Time.Before(collection.LastNow) {
+		profile.Time = collection.LastNow
 	}
 
-	collection := summary.Collection
 	index := collection.UpdateToTime(profile.Time)
+	summary.cycles[profile.Process.ID] = profile.NumGC
+	summary.addGauges(profile)
+	summary.addGCs(profile)
+	for pc, frame := range profile.Frames {
+		syms.binary.AddFrame(pc, frame)
+	}
 	for i := range profile.Records {
 		rec := &profile.Records[i]
 		for i, frame := range rec.Stack0 {
 			if frame == 0 {
 				break
 			}
-			rec.Stack0[i] = uintptr(int64(frame) + summary.Symbols.Offset)
+			rec.Stack0[i] = uintptr(int64(frame) + syms.offset)
 		}
 
-		// TODO: implement skip runtime
-		collection.UpdateSample(index, rec.Stack0[:], series.Sample{
+		typ := ""
+		if i < len(profile.Types) {
+			typ = profile.Types[i]
+		}
+		full := collection.UpdateSample(index, profile.Process.ID, typ, rec.Stack0[:], series.Sample{
 			AllocBytes:   rec.AllocBytes,
 			FreeBytes:    rec.FreeBytes,
 			AllocObjects: rec.AllocObjects,
 			FreeObjects:  rec.FreeObjects,
 		})
+		summary.addLifetimes(profile, i, full)
 	}
 
 	// TODO: reuse profile allocation
 }
 
-func (summary *Summary) StackAsString(stack []uintptr) string {
-	var s bytes.Buffer
+// Leaks returns series with steadily growing live bytes, sorted by growth.
+//
+// The leaks are detected again only when a new sample starts or
+// the series are regrouped.
+func (summary *Summary) Leaks() []series.Leak {
+	summary.updateLeaks()
+	return summary.leaks.list
+}
+
+// Leak returns whether the series is leaking.
+func (summary *Summary) Leak(s *series.Series) (series.Leak, bool) {
+	summary.updateLeaks()
+	leak, ok := summary.leaks.bySeries[s]
+	return leak, ok
+}
+
+func (summary *Summary) updateLeaks() {
+	collection := summary.Collection
+	cache := &summary.leaks
+	if cache.valid && cache.head == collection.SampleHead &&
+		cache.depth == collection.Depth && cache.grouping == collection.Grouping {
+		return
+	}
+
+	cache.valid = true
+	cache.head = collection.SampleHead
+	cache.depth = collection.Depth
+	cache.grouping = collection.Grouping
+	cache.list = summary.LeakDetector.Detect(&collection.Collection, collection.List)
+	cache.bySeries = make(map[*series.Series]series.Leak, len(cache.list))
+	for _, leak := range cache.list {
+		cache.bySeries[leak.Series] = leak
+	}
+}
+
+// groupStack returns the frames of stack that are used for grouping.
+func (summary *Summary) groupStack(process int, stack, dst []uintptr) []uintptr {
+	syms, ok := summary.symbols[process]
+	if !ok {
+		return stack
+	}
+	return summary.filterStack(syms, stack, dst)
+}
+
+// filterStack appends frames that are not skipped by the filter to dst.
+// When all frames would be skipped, stack is returned unmodified.
+func (summary *Summary) filterStack(syms *processSymbols, stack, dst []uintptr) []uintptr {
+	filter := &summary.Config.Filter
+	if syms.binary == nil || !filter.Enabled() {
+		return stack
+	}
+
 	for _, frame := range stack {
 		if frame == 0 {
 			break
 		}
 
-		file, line, _ := summary.Symbols.SymTable.PCToLine(uint64(frame))
-		if file == "" {
-			fmt.Fprintf(&s, "0x%x\n", frame)
-			continue
+		skip, ok := syms.skip[frame]
+		if !ok {
+			sym, _ := syms.binary.Frame(frame)
+			skip = sym.Func != "" && filter.Skip(sym.Func)
+			syms.skip[frame] = skip
 		}
-		fmt.Fprintf(&s, "%s:%v\n", file, line)
+		if !skip {
+			dst = append(dst, frame)
+		}
+	}
+
+	if len(dst) == 0 {
+		return stack
+	}
+	return dst
+}
+
+// processSymbols returns symbols for the process, loading the binary when necessary.
+func (summary *Summary) processSymbols(process *Process) *processSymbols {
+	if syms, ok := summary.symbols[process.ID]; ok {
+		return syms
+	}
+	summary.Processes = append(summary.Processes, process)
+
+	syms := &processSymbols{skip: map[uintptr]bool{}}
+	summary.symbols[process.ID] = syms
+
+	if process.Traced {
+		syms.binary = symbols.NewBinary()
+		return syms
+	}
+
+	binary, ok := summary.Binaries[process.ExeName]
+	if !ok {
+		var err error
+		binary, err = symbols.Load(process.ExeName)
+		if err != nil {
+			log.Printf("unable to load symbols for %q: %v", process.ExeName, err)
+		}
+		summary.Binaries[process.ExeName] = binary
+	}
+	if binary == nil {
+		return syms
+	}
+
+	syms.binary = binary
+	syms.offset, ok = binary.FuncOffset(process.FuncName, process.FuncAddr)
+	if !ok {
+		log.Printf("unable to find %q in %q", process.FuncName, process.ExeName)
+	}
+	return syms
+}
+
+// Process returns the process with the specified ID.
+func (summary *Summary) Process(id int) *Process {
+	for _, process := range summary.Processes {
+		if process.ID == id {
+			return process
+		}
+	}
+	return nil
+}
+
+// ProcessName returns a short description of the process.
+func (summary *Summary) ProcessName(id int) string {
+	process := summary.Process(id)
+	if process == nil {
+		return "?"
+	}
+	return fmt.Sprintf("%s [%d]", filepath.Base(process.ExeName), process.PID)
+}
+
+// GCCycles returns the number of completed GC cycles in the process.
+func (summary *Summary) GCCycles(process int) uint32 {
+	return summary.cycles[process]
+}
+
+// Binary returns symbols for the process, it returns nil when they are not available.
+func (summary *Summary) Binary(process int) *symbols.Binary {
+	if syms, ok := summary.symbols[process]; ok {
+		return syms.binary
+	}
+	return nil
+}
+
+func (summary *Summary) StackAsString(process int, stack []uintptr) string {
+	binary := summary.Binary(process)
+
+	var s bytes.Buffer
+	for _, frame := range stack {
+		if frame == 0 {
+			break
+		}
+		s.WriteString(summary.FrameAsString(binary, frame))
+		s.WriteByte('\n')
 	}
 	return s.String()
 }
+
+// FrameAsString formats the frame according to Config.Caption.
+func (summary *Summary) FrameAsString(binary *symbols.Binary, frame uintptr) string {
+	if binary == nil {
+		return fmt.Sprintf("0x%x", frame)
+	}
+
+	sym, ok := binary.Frame(frame)
+	if !ok {
+		return fmt.Sprintf("0x%x", frame)
+	}
+	return summary.Config.Caption.FormatFrame(sym.Func, sym.File, sym.Line)
+}
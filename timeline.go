@@ -0,0 +1,212 @@
+package main
+
+import (
+	"image"
+	"strconv"
+	"time"
+
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+
+	"loov.dev/allocview/internal/series"
+)
+
+// MaxZoom is the maximum number of samples combined into a single bar.
+const MaxZoom = 64
+
+// Timeline defines which samples are displayed.
+type Timeline struct {
+	// Paused freezes the displayed samples.
+	Paused bool
+	// Head is the latest displayed sample when paused.
+	Head int
+	// Offset is the number of samples scrolled back from the head.
+	Offset int
+	// Zoom is the number of samples combined into a single bar.
+	Zoom int
+
+	dragging bool
+	dragX    float32
+}
+
+// TogglePause pauses or resumes following the latest samples.
+func (timeline *Timeline) TogglePause(coll *series.Collection) {
+	if timeline.Paused {
+		timeline.Resume()
+		return
+	}
+	timeline.Paused = true
+	timeline.Head = coll.SampleHead
+}
+
+// Resume starts following the latest samples.
+func (timeline *Timeline) Resume() {
+	timeline.Paused = false
+	timeline.Offset = 0
+}
+
+// ZoomIn decreases the number of samples in a single bar.
+func (timeline *Timeline) ZoomIn() {
+	if timeline.Zoom > 1 {
+		timeline.Zoom /= 2
+	}
+}
+
+// ZoomOut increases the number of samples in a single bar.
+func (timeline *Timeline) ZoomOut() {
+	if timeline.Zoom < MaxZoom {
+		timeline.Zoom *= 2
+	}
+}
+
+// Pan moves the displayed range by the specified number of bars,
+// positive values move back in time.
+//
+// Panning pauses the timeline, so that the displayed samples don't move.
+func (timeline *Timeline) Pan(coll *series.Collection, bars int) {
+	if !timeline.Paused {
+		timeline.TogglePause(coll)
+	}
+
+	timeline.Offset += bars * timeline.Zoom
+	if timeline.Offset < 0 {
+		timeline.Offset = 0
+	}
+	// keep at least a single sample from the ring-buffer visible
+	if max := timeline.Head - (coll.SampleHead - coll.SampleCount + 1); timeline.Offset > max {
+		timeline.Offset = max
+	}
+	if timeline.Offset < 0 {
+		timeline.Offset = 0
+	}
+}
+
+// Range returns the sample time range [low, high) for displaying the
+// specified number of bars. The range is aligned to Zoom, so that the bars
+// don't change when new samples arrive.
+func (timeline *Timeline) Range(coll *series.Collection, bars int) (low, high int) {
+	head := coll.SampleHead
+	if timeline.Paused {
+		head = timeline.Head
+	}
+	last := head - timeline.Offset
+
+	high = last - series.Mod(last, timeline.Zoom) + timeline.Zoom
+	low = high - bars*timeline.Zoom
+	return low, high
+}
+
+// Bins returns the displayed samples of s, combining Zoom samples into a single bar.
+func (timeline *Timeline) Bins(coll *series.Collection, s *series.Series, bars int) []series.Sample {
+	bins := make([]series.Sample, bars)
+	for i := range bins {
+		from, to := timeline.Bar(coll, bars, i)
+		bins[i] = s.Range(coll.SampleHead, from, to)
+	}
+	return bins
+}
+
+// Bar returns the sample time range [from, to) of the i-th bar.
+func (timeline *Timeline) Bar(coll *series.Collection, bars, i int) (from, to int) {
+	low, _ := timeline.Range(coll, bars)
+	last := timeline.Last(coll)
+
+	from = low + i*timeline.Zoom
+	to = from + timeline.Zoom
+	if to > last+1 {
+		to = last + 1
+	}
+	return from, to
+}
+
+// After returns the sum of samples of s following the displayed bars.
+func (timeline *Timeline) After(coll *series.Collection, s *series.Series, bars int) series.Sample {
+	return s.Range(coll.SampleHead, timeline.Last(coll)+1, coll.SampleHead+1)
+}
+
+// Tooltip describes the sample of the bar covering time range [from, to).
+func Tooltip(coll *series.Collection, from, to int, sample series.Sample) string {
+	const format = "15:04:05.000"
+	text := coll.SampleTime(from).Format(format)
+	if to-from > 1 {
+		text += " - " + coll.SampleTime(to).Format(format)
+	}
+	text += "\nalloc " + SizeToString(sample.AllocBytes) + " / " + strconv.Itoa(int(sample.AllocObjects)) + " objects"
+	text += "\nfree " + SizeToString(sample.FreeBytes) + " / " + strconv.Itoa(int(sample.FreeObjects)) + " objects"
+	return text
+}
+
+// Last returns the latest displayed sample time.
+func (timeline *Timeline) Last(coll *series.Collection) int {
+	if timeline.Paused {
+		return timeline.Head - timeline.Offset
+	}
+	return coll.SampleHead - timeline.Offset
+}
+
+// Status describes the state of the timeline.
+func (timeline *Timeline) Status(coll *series.Collection) string {
+	text := "live (Space to pause)"
+	if timeline.Paused {
+		text = "paused (Space to resume)"
+	}
+	if timeline.Offset > 0 {
+		back := time.Duration(coll.SampleHead-timeline.Last(coll)) * coll.SampleDuration
+		text += ", " + back.String() + " ago"
+	}
+	text += ", " + strconv.Itoa(timeline.Zoom) + " samples per bar (Z and Shift-Z to zoom)"
+	return text
+}
+
+// Input registers pointer input for area.
+func (timeline *Timeline) Input(gtx layout.Context, area image.Rectangle) {
+	defer clip.Rect(area).Push(gtx.Ops).Pop()
+	pointer.InputOp{
+		Tag:   timeline,
+		Types: pointer.Press | pointer.Drag | pointer.Release | pointer.Scroll,
+		// only horizontal scrolling, vertical scrolling is used by the list
+		ScrollBounds: image.Rectangle{
+			Min: image.Point{X: -1 << 20},
+			Max: image.Point{X: 1 << 20},
+		},
+	}.Add(gtx.Ops)
+}
+
+// Update handles dragging and scrolling.
+func (timeline *Timeline) Update(gtx layout.Context, coll *series.Collection) {
+	barWidth := float32(SampleWidth)
+	for _, ev := range gtx.Events(timeline) {
+		ev, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+
+		switch ev.Type {
+		case pointer.Press:
+			timeline.dragging = true
+			timeline.dragX = ev.Position.X
+		case pointer.Drag:
+			if !timeline.dragging {
+				break
+			}
+			bars := int((ev.Position.X - timeline.dragX) / barWidth)
+			if bars != 0 {
+				timeline.Pan(coll, bars)
+				timeline.dragX += float32(bars) * barWidth
+			}
+		case pointer.Release, pointer.Cancel:
+			timeline.dragging = false
+		case pointer.Scroll:
+			bars := int(ev.Scroll.X / barWidth)
+			if bars == 0 && ev.Scroll.X != 0 {
+				bars = 1
+				if ev.Scroll.X < 0 {
+					bars = -1
+				}
+			}
+			// scrolling right moves forward in time
+			timeline.Pan(coll, -bars)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"loov.dev/allocview/internal/allocfreetrace"
+	"loov.dev/allocview/internal/series"
+	"loov.dev/allocview/internal/symbols"
+)
+
+// Trace starts cmd with GODEBUG=allocfreetrace=1 and monitors
+// the allocations written to its standard error.
+//
+// This works with programs that don't import the attach package,
+// however the program runs considerably slower and its standard
+// error is consumed by the trace.
+func (server *Server) Trace(ctx context.Context, group *errgroup.Group, cmd *exec.Cmd) error {
+	godebug := "allocfreetrace=1"
+	if v := os.Getenv("GODEBUG"); v != "" {
+		godebug = v + "," + godebug
+	}
+	cmd.Env = append(os.Environ(), "GODEBUG="+godebug)
+
+	cmd.Stderr = nil
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start %q: %w", cmd.Args, err)
+	}
+
+	process := &Process{
+		ID:      server.nextProcessID(),
+		PID:     cmd.Process.Pid,
+		ExeName: cmd.Path,
+		Rate:    1,
+		Traced:  true,
+	}
+	log.Printf("tracing process %d: %s", process.PID, process.ExeName)
+
+	events := make(chan allocfreetrace.Event, 1024)
+	group.Go(func() error {
+		err := readEvents(stderr, events)
+		close(events)
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return fmt.Errorf("failed to read trace: %w", err)
+		}
+
+		// the pipe must be read fully before waiting
+		err = cmd.Wait()
+		log.Printf("program exited: %v", err)
+		return err
+	})
+
+	group.Go(func() error {
+		interval := server.Interval
+		if interval <= 0 {
+			interval = time.Second / 10
+		}
+		server.readTrace(newTracer(process), events, interval)
+		return nil
+	})
+
+	return nil
+}
+
+// readEvents reads the events from the trace until the end.
+func readEvents(r io.Reader, events chan<- allocfreetrace.Event) error {
+	reader := allocfreetrace.NewReader(r)
+	for {
+		event, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		events <- event
+	}
+}
+
+// noTraceWarningDelay is how long to wait for the first event
+// before warning that the program isn't traced.
+const noTraceWarningDelay = 5 * time.Second
+
+// readTrace sends the events as a profile every interval.
+func (server *Server) readTrace(tracer *tracer, events <-chan allocfreetrace.Event, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	// the runtime ignores allocfreetrace since Go 1.22
+	traced, warned := false, false
+	warnNoTrace := func() {
+		if !traced && !warned {
+			log.Printf("no allocations traced, GODEBUG=allocfreetrace=1 requires a program built with Go older than 1.22")
+			warned = true
+		}
+	}
+	noTrace := time.NewTimer(noTraceWarningDelay)
+	defer noTrace.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				warnNoTrace()
+				server.profiles <- tracer.finish(time.Now())
+				return
+			}
+			traced = true
+			tracer.add(event, time.Now())
+		case <-noTrace.C:
+			warnNoTrace()
+		case now := <-tick.C:
+			server.profiles <- tracer.flush(now)
+		}
+	}
+}
+
+// tracer converts allocfreetrace events to profiles.
+//
+// The stacks in the trace don't contain addresses for all frames,
+// hence each distinct frame is assigned an id, which is used
+// in place of the address.
+//
+// The time of an event is the time it was read, which is
+// delayed by the buffering of the output.
+type tracer struct {
+	process *Process
+	// cycle is the number of completed GC cycles.
+	cycle uint32
+
+	frames    map[allocfreetrace.Frame]uintptr
+	newFrames map[uintptr]symbols.Frame
+
+	// live contains the allocated objects by their address,
+	// since frees are reported with the stack of the sweeper.
+	live map[allocfreetrace.Address]liveObject
+
+	samples   map[traceKey]series.Sample
+	lifetimes map[traceKey]*series.Lifetime
+}
+
+// liveObject describes an allocated object that hasn't been freed.
+type liveObject struct {
+	key   traceKey
+	cycle uint32
+	time  time.Time
+}
+
+// traceKey identifies the allocations of a type at a stack.
+type traceKey struct {
+	typ   string
+	stack [32]uintptr
+}
+
+func newTracer(process *Process) *tracer {
+	return &tracer{
+		process:   process,
+		frames:    map[allocfreetrace.Frame]uintptr{},
+		newFrames: map[uintptr]symbols.Frame{},
+		live:      map[allocfreetrace.Address]liveObject{},
+		samples:   map[traceKey]series.Sample{},
+		lifetimes: map[traceKey]*series.Lifetime{},
+	}
+}
+
+// add adds the event that was read at now to the pending profile.
+func (tracer *tracer) add(event allocfreetrace.Event, now time.Time) {
+	switch event.Kind {
+	case allocfreetrace.GC:
+		tracer.cycle++
+	case allocfreetrace.Alloc:
+		key := traceKey{typ: event.Type, stack: tracer.stack(event.Stack)}
+		tracer.live[event.Address] = liveObject{
+			key:   key,
+			cycle: tracer.cycle,
+			time:  now,
+		}
+
+		sample := tracer.samples[key]
+		sample.AllocBytes += event.Size
+		sample.AllocObjects++
+		tracer.samples[key] = sample
+	case allocfreetrace.Free:
+		object, ok := tracer.live[event.Address]
+		if !ok {
+			return
+		}
+		delete(tracer.live, event.Address)
+
+		// objects are freed after the cycle that found them unreachable
+		key := object.key
+		lifetime := tracer.lifetime(key)
+		lifetime.Add(int64(tracer.cycle-object.cycle)-1, now.Sub(object.time))
+
+		sample := tracer.samples[key]
+		sample.FreeBytes += event.Size
+		sample.FreeObjects++
+		tracer.samples[key] = sample
+	}
+}
+
+// stack converts the text of the stack to frame ids.
+func (tracer *tracer) stack(text string) [32]uintptr {
+	var stack [32]uintptr
+	for i, frame := range allocfreetrace.ParseStack(text) {
+		if i >= len(stack) {
+			break
+		}
+
+		id, ok := tracer.frames[frame]
+		if !ok {
+			id = uintptr(len(tracer.frames) + 1)
+			tracer.frames[frame] = id
+			tracer.newFrames[id] = symbols.Frame{
+				Func: frame.Func,
+				File: frame.File,
+				Line: frame.Line,
+			}
+		}
+		stack[i] = id
+	}
+
+	return stack
+}
+
+// lifetime returns the pending lifetimes of the freed objects.
+func (tracer *tracer) lifetime(key traceKey) *series.Lifetime {
+	lifetime, ok := tracer.lifetimes[key]
+	if !ok {
+		lifetime = &series.Lifetime{}
+		tracer.lifetimes[key] = lifetime
+	}
+	return lifetime
+}
+
+// finish returns the last profile, which includes the objects
+// that were never freed.
+func (tracer *tracer) finish(now time.Time) *Profile {
+	unfreed := map[traceKey]*series.Lifetime{}
+	for _, object := range tracer.live {
+		lifetime, ok := unfreed[object.key]
+		if !ok {
+			lifetime = &series.Lifetime{}
+			unfreed[object.key] = lifetime
+		}
+		lifetime.Add(int64(tracer.cycle-object.cycle), now.Sub(object.time))
+
+		// ensure that there's a record for each stack
+		if _, ok := tracer.samples[object.key]; !ok {
+			tracer.samples[object.key] = series.Sample{}
+		}
+	}
+
+	profile := tracer.flush(now)
+	profile.Unfreed = make([]series.Lifetime, len(profile.Records))
+	for i, rec := range profile.Records {
+		key := traceKey{typ: profile.Types[i], stack: rec.Stack0}
+		if lifetime, ok := unfreed[key]; ok {
+			profile.Unfreed[i] = *lifetime
+		}
+	}
+	return profile
+}
+
+// flush returns the pending profile.
+func (tracer *tracer) flush(now time.Time) *Profile {
+	profile := &Profile{
+		Process:   tracer.process,
+		Time:      now,
+		NumGC:     tracer.cycle,
+		Records:   make([]runtime.MemProfileRecord, 0, len(tracer.samples)),
+		Types:     make([]string, 0, len(tracer.samples)),
+		Lifetimes: make([]series.Lifetime, 0, len(tracer.samples)),
+		Frames:    tracer.newFrames,
+	}
+
+	for key, sample := range tracer.samples {
+		profile.Records = append(profile.Records, runtime.MemProfileRecord{
+			AllocBytes:   sample.AllocBytes,
+			FreeBytes:    sample.FreeBytes,
+			AllocObjects: sample.AllocObjects,
+			FreeObjects:  sample.FreeObjects,
+			Stack0:       key.stack,
+		})
+		profile.Types = append(profile.Types, key.typ)
+
+		var lifetime series.Lifetime
+		if pending, ok := tracer.lifetimes[key]; ok {
+			lifetime = *pending
+		}
+		profile.Lifetimes = append(profile.Lifetimes, lifetime)
+	}
+
+	tracer.newFrames = map[uintptr]symbols.Frame{}
+	tracer.samples = map[traceKey]series.Sample{}
+	tracer.lifetimes = map[traceKey]*series.Lifetime{}
+	return profile
+}
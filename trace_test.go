@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"loov.dev/allocview/internal/allocfreetrace"
+	"loov.dev/allocview/internal/series"
+)
+
+func TestTracer(t *testing.T) {
+	file, err := os.Open("internal/allocfreetrace/allocfree.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	type typeStats struct {
+		sample  series.Sample
+		freed   series.Lifetime
+		unfreed series.Lifetime
+	}
+	stats := map[string]*typeStats{}
+	addProfile := func(profile *Profile) {
+		for i, rec := range profile.Records {
+			s, ok := stats[profile.Types[i]]
+			if !ok {
+				s = &typeStats{}
+				stats[profile.Types[i]] = s
+			}
+			s.sample.Add(series.Sample{
+				AllocBytes:   rec.AllocBytes,
+				FreeBytes:    rec.FreeBytes,
+				AllocObjects: rec.AllocObjects,
+				FreeObjects:  rec.FreeObjects,
+			})
+			s.freed.Merge(&profile.Lifetimes[i])
+			if profile.Unfreed != nil {
+				s.unfreed.Merge(&profile.Unfreed[i])
+			}
+		}
+	}
+
+	tracer := newTracer(&Process{ID: 1, Traced: true})
+	reader := allocfreetrace.NewReader(file)
+	now := time.Now()
+	for i := 0; ; i++ {
+		event, err := reader.Read()
+		if err != nil {
+			break
+		}
+		now = now.Add(time.Millisecond)
+		tracer.add(event, now)
+
+		// the lifetimes must be kept across profiles
+		if i%50 == 49 {
+			addProfile(tracer.flush(now))
+		}
+	}
+	addProfile(tracer.finish(now))
+
+	if tracer.cycle != 6 {
+		t.Errorf("got %d GC cycles, expected 6", tracer.cycle)
+	}
+
+	var freed int64
+	for _, s := range stats {
+		freed += s.sample.FreeObjects
+	}
+	// one of the frees is for an object allocated before the trace
+	if freed != 23 {
+		t.Errorf("got %d freed objects, expected 23", freed)
+	}
+
+	expect := []struct {
+		typ     string
+		allocs  int64
+		frees   int64
+		freed   string
+		unfreed string
+	}{
+		{typ: "uint8", allocs: 15, frees: 9, freed: "0: 4, 1: 5", unfreed: "1: 1, 3-4: 1, 5-8: 4"},
+		{typ: "main.Node", allocs: 15, frees: 9, freed: "0: 5, 1: 4", unfreed: "1: 1, 3-4: 1, 5-8: 4"},
+		{typ: "*runtime.g", allocs: 5, frees: 4, freed: "0: 3, 3-4: 1", unfreed: "3-4: 1"},
+	}
+	for _, exp := range expect {
+		s, ok := stats[exp.typ]
+		if !ok {
+			t.Errorf("%s: missing", exp.typ)
+			continue
+		}
+		if s.sample.AllocObjects != exp.allocs || s.sample.FreeObjects != exp.frees {
+			t.Errorf("%s: got %d allocs and %d frees, expected %d and %d", exp.typ,
+				s.sample.AllocObjects, s.sample.FreeObjects, exp.allocs, exp.frees)
+		}
+		if s.freed.Count != exp.frees || s.freed.CyclesString() != exp.freed {
+			t.Errorf("%s: got freed %d objects in %q, expected %q", exp.typ, s.freed.Count, s.freed.CyclesString(), exp.freed)
+		}
+		if s.unfreed.Count != exp.allocs-exp.frees || s.unfreed.CyclesString() != exp.unfreed {
+			t.Errorf("%s: got unfreed %d objects in %q, expected %q", exp.typ, s.unfreed.Count, s.unfreed.CyclesString(), exp.unfreed)
+		}
+	}
+}
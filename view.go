@@ -3,41 +3,134 @@ package main
 import (
 	"image"
 	"image/color"
+	"log"
+	"math"
 	"sort"
 	"strconv"
 	"time"
 
 	"gioui.org/app"
 	"gioui.org/font/gofont"
+	"gioui.org/gesture"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
 	"gioui.org/io/system"
 	"gioui.org/layout"
 	"gioui.org/op"
 	"gioui.org/op/clip"
 	"gioui.org/op/paint"
 	"gioui.org/unit"
+	"gioui.org/widget"
 	"gioui.org/widget/material"
 
 	"loov.dev/allocview/internal/g"
+	"loov.dev/allocview/internal/series"
 )
 
 type Config struct {
 	SampleDuration time.Duration
 	SampleCount    int
+
+	// Depth is the number of stack frames used for grouping.
+	Depth int
+	// Group defines whether series are grouped by stack or type.
+	Group GroupMode
+	// Filter skips frames before grouping.
+	Filter FrameFilter
+	// Caption defines how frames are displayed.
+	Caption CaptionMode
+	// Metric defines the displayed values.
+	Metric Metric
+	// Sort defines the order of series.
+	Sort SortOrder
+	// RecentSamples is the number of samples used by SortRecent.
+	RecentSamples int
+
+	// PprofPath is where the pprof profile is exported.
+	PprofPath string
+
+	// LeakWindow is the duration used for detecting leaks.
+	LeakWindow time.Duration
 }
 
 type View struct {
 	Server  *Server
 	Summary *Summary
 
+	// process is the ID of the displayed process, 0 displays all.
+	process int
+
+	search        widget.Editor
+	searchRegexp  widget.Bool
+	searchExclude widget.Bool
+	filter        SeriesFilter
+
+	timeline Timeline
+
+	rows     map[*series.Series]*rowState
+	selected *series.Series
+	details  layout.List
+
+	// runtimeRows contains the input state of the heap and GC rows.
+	runtimeRows [2]rowState
+	// gcMarks caches the bars that contain a GC cycle for the current frame.
+	gcMarks []bool
+
+	// sorted contains the series in the displayed order.
+	sorted []*series.Series
+	// frozen contains the position of each series when the order is frozen.
+	frozen map[*series.Series]int
+	pinned map[*series.Series]bool
+
 	series layout.List
 }
 
+// rowState contains the input state of a displayed series.
+type rowState struct {
+	click gesture.Click
+
+	// hovering is set when the pointer is over the timeline at hoverX.
+	hovering bool
+	hoverX   int
+}
+
+// Hover registers pointer input for showing tooltips in area.
+func (row *rowState) Hover(gtx layout.Context, area image.Rectangle) {
+	defer clip.Rect(area).Push(gtx.Ops).Pop()
+	pointer.InputOp{
+		Tag:   row,
+		Types: pointer.Enter | pointer.Move | pointer.Drag | pointer.Leave,
+	}.Add(gtx.Ops)
+}
+
+// UpdateHover handles pointer movement over the timeline.
+func (row *rowState) UpdateHover(gtx layout.Context) {
+	for _, ev := range gtx.Events(row) {
+		ev, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch ev.Type {
+		case pointer.Enter, pointer.Move, pointer.Drag:
+			row.hovering = true
+			row.hoverX = int(ev.Position.X)
+		case pointer.Leave, pointer.Cancel:
+			row.hovering = false
+		}
+	}
+}
+
 func NewView(config Config, server *Server) *View {
 	return &View{
 		Server:  server,
 		Summary: NewSummary(config),
 
-		series: layout.List{Axis: layout.Vertical},
+		search:   widget.Editor{SingleLine: true},
+		timeline: Timeline{Zoom: 1},
+		rows:     map[*series.Series]*rowState{},
+		pinned:   map[*series.Series]bool{},
+		details:  layout.List{Axis: layout.Vertical},
+		series:   layout.List{Axis: layout.Vertical},
 	}
 }
 
@@ -49,6 +142,9 @@ func (view *View) Run(w *app.Window) error {
 		case e := <-w.Events():
 			switch e := e.(type) {
 			case system.DestroyEvent:
+				if view.Summary.Config.PprofPath != "" {
+					view.exportPprof()
+				}
 				return e.Err
 			case system.FrameEvent:
 				gtx := layout.NewContext(&ops, e)
@@ -63,38 +159,411 @@ func (view *View) Run(w *app.Window) error {
 	}
 }
 
+// viewKeys are the keyboard shortcuts handled by the view.
+const viewKeys = "E|F|G|M|O|P|S|[|]|Z|Shift-Z|" +
+	key.NameSpace + "|" + key.NameLeftArrow + "|" + key.NameRightArrow + "|" + key.NameEnd + "|" + key.NameEscape
+
 const (
 	SeriesHeight  = 50
+	RuntimeHeight = 30
 	SeriesPadding = 5
 	CaptionHeight = 12
 	SampleWidth   = 3
 	CaptionWidth  = CaptionHeight * 20
 )
 
+// exportPprof writes the pprof profile to the configured path
+// or to a timestamped file in the current directory.
+func (view *View) exportPprof() {
+	path := view.Summary.Config.PprofPath
+	if path == "" {
+		path = "allocview-" + time.Now().Format("20060102-150405") + ".pb.gz"
+	}
+
+	err := view.Summary.ExportPprof(path)
+	if err != nil {
+		log.Printf("failed to export pprof: %v", err)
+		return
+	}
+	log.Printf("exported pprof to %q", path)
+}
+
 func (view *View) Update(gtx layout.Context, th *material.Theme) {
+	for _, ev := range gtx.Events(view) {
+		// keys typed into the search box are also delivered to the view
+		if view.search.Focused() {
+			// Esc clears the search and leaves the search box
+			if ev, ok := ev.(key.Event); ok && ev.State == key.Press && ev.Name == key.NameEscape {
+				view.search.SetText("")
+				key.FocusOp{Tag: nil}.Add(gtx.Ops)
+			}
+			continue
+		}
+		if ev, ok := ev.(key.Event); ok && ev.State == key.Press {
+			switch ev.Name {
+			case "E":
+				view.exportPprof()
+			case "P":
+				view.nextProcess()
+			case "F":
+				view.Summary.Config.Caption = view.Summary.Config.Caption.Next()
+			case "G":
+				view.Summary.SetGroup(view.Summary.Config.Group.Next())
+			case "M":
+				view.Summary.Config.Metric = view.Summary.Config.Metric.Next()
+			case "S":
+				view.Summary.Config.Sort = view.Summary.Config.Sort.Next()
+			case "O":
+				view.toggleFreeze()
+			case "[":
+				view.Summary.Collection.SetDepth(view.Summary.Collection.Depth - 1)
+			case "]":
+				view.Summary.Collection.SetDepth(view.Summary.Collection.Depth + 1)
+			case key.NameSpace:
+				view.timeline.TogglePause(&view.Summary.Collection.Collection)
+			case key.NameLeftArrow:
+				view.timeline.Pan(&view.Summary.Collection.Collection, 10)
+			case key.NameRightArrow:
+				view.timeline.Pan(&view.Summary.Collection.Collection, -10)
+			case key.NameEnd:
+				view.timeline.Resume()
+			case key.NameEscape:
+				view.selected = nil
+			case "Z":
+				if ev.Modifiers.Contain(key.ModShift) {
+					view.timeline.ZoomIn()
+				} else {
+					view.timeline.ZoomOut()
+				}
+			}
+		}
+	}
+	key.InputOp{Tag: view, Keys: viewKeys}.Add(gtx.Ops)
+	view.gcMarks = nil
+	view.timeline.Update(gtx, &view.Summary.Collection.Collection)
+
 	paint.Fill(gtx.Ops, BackgroundColor)
 
 	collection := view.Summary.Collection
-	sort.SliceStable(collection.List, func(i, k int) bool {
-		return collection.List[i].TotalAllocBytes > collection.List[k].TotalAllocBytes
+	// collection.List is kept in the order the series were first seen
+	view.sorted = append(view.sorted[:0], collection.List...)
+	view.Summary.Sort(view.sorted)
+	view.reorder(view.sorted)
+
+	list := view.sorted
+	if view.process != 0 {
+		list = nil
+		for _, series := range view.sorted {
+			if series.Process == view.process {
+				list = append(list, series)
+			}
+		}
+	}
+
+	view.filter.Exclude = view.searchExclude.Value
+	view.filter.SetPattern(view.search.Text(), view.searchRegexp.Value)
+	list = view.filter.Filter(view.Summary, list)
+
+	// regrouping replaces all series
+	if view.selected != nil && !containsSeries(collection.List, view.selected) {
+		view.selected = nil
+	}
+	for pinned := range view.pinned {
+		if !containsSeries(collection.List, pinned) {
+			delete(view.pinned, pinned)
+		}
+	}
+	if len(view.rows) > 2*len(collection.List) {
+		view.rows = map[*series.Series]*rowState{}
+	}
+
+	layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return view.layoutHeader(gtx, th, len(list))
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return view.layoutRuntime(gtx, th)
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return view.layoutSeries(gtx, th, list)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return view.layoutDetails(gtx, th)
+		}),
+	)
+}
+
+// toggleFreeze freezes or unfreezes the order of the displayed series.
+func (view *View) toggleFreeze() {
+	if view.frozen != nil {
+		view.frozen = nil
+		return
+	}
+	view.frozen = make(map[*series.Series]int, len(view.sorted))
+	for i, s := range view.sorted {
+		view.frozen[s] = i
+	}
+}
+
+// togglePin pins or unpins the series to the top of the list.
+func (view *View) togglePin(s *series.Series) {
+	if view.pinned[s] {
+		delete(view.pinned, s)
+	} else {
+		view.pinned[s] = true
+	}
+}
+
+// reorder moves pinned series to the top and keeps the frozen order,
+// series that have been added after freezing are placed at the end.
+func (view *View) reorder(list []*series.Series) {
+	if view.frozen != nil {
+		rank := func(s *series.Series) int {
+			if i, ok := view.frozen[s]; ok {
+				return i
+			}
+			return len(view.frozen)
+		}
+		sort.SliceStable(list, func(i, k int) bool {
+			return rank(list[i]) < rank(list[k])
+		})
+	}
+	if len(view.pinned) > 0 {
+		sort.SliceStable(list, func(i, k int) bool {
+			return view.pinned[list[i]] && !view.pinned[list[k]]
+		})
+	}
+}
+
+func containsSeries(list []*series.Series, target *series.Series) bool {
+	for _, s := range list {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
+
+// row returns the input state for the series.
+func (view *View) row(s *series.Series) *rowState {
+	row, ok := view.rows[s]
+	if !ok {
+		row = &rowState{}
+		view.rows[s] = row
+	}
+	return row
+}
+
+// layoutDetails displays the details of the selected series.
+func (view *View) layoutDetails(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	if view.selected == nil {
+		return layout.Dimensions{}
+	}
+
+	size := image.Pt(gtx.Constraints.Max.X, gtx.Constraints.Max.Y*2/5)
+	gtx.Constraints = layout.Exact(size)
+	FillRect(gtx.Ops, RowBackgroundOddH, image.Rectangle{Max: size})
+
+	lines := append([]string{"Details (Esc to close)"}, view.Summary.Details(view.selected)...)
+	inset := layout.UniformInset(unit.Dp(SeriesPadding))
+	return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return view.details.Layout(gtx, len(lines), func(gtx layout.Context, i int) layout.Dimensions {
+			label := material.Label(th, unit.Sp(CaptionHeight-1), lines[i])
+			label.Color = TextColor
+			label.MaxLines = 1
+			return label.Layout(gtx)
+		})
 	})
+}
+
+// nextProcess cycles through the displayed processes.
+func (view *View) nextProcess() {
+	processes := view.Summary.Processes
+	if view.process == 0 {
+		if len(processes) > 0 {
+			view.process = processes[0].ID
+		}
+		return
+	}
+
+	for i, process := range processes {
+		if process.ID == view.process {
+			if i+1 < len(processes) {
+				view.process = processes[i+1].ID
+			} else {
+				view.process = 0
+			}
+			return
+		}
+	}
+	view.process = 0
+}
+
+// layoutHeader displays the search box, grouping and information about the monitored processes.
+func (view *View) layoutHeader(gtx layout.Context, th *material.Theme, shown int) layout.Dimensions {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return view.layoutSearch(gtx, th)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return view.layoutStatus(gtx, th, shown)
+		}),
+	)
+}
+
+// layoutSearch displays the series filter.
+func (view *View) layoutSearch(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	inset := layout.UniformInset(unit.Dp(SeriesPadding))
+	return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				macro := op.Record(gtx.Ops)
+				dims := inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					editor := material.Editor(th, &view.search, "Filter by function, package or file")
+					editor.TextSize = unit.Sp(CaptionHeight)
+					editor.Color = TextColor
+					editor.HintColor = HintColor
+					if view.filter.Err() != nil {
+						editor.Color = ErrorColor
+					}
+					return editor.Layout(gtx)
+				})
+				call := macro.Stop()
+
+				FillRect(gtx.Ops, RowBackgroundOdd, image.Rectangle{Max: dims.Size})
+				call.Add(gtx.Ops)
+				return dims
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return view.layoutCheckBox(gtx, th, &view.searchRegexp, "Regexp")
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return view.layoutCheckBox(gtx, th, &view.searchExclude, "Exclude")
+			}),
+		)
+	})
+}
+
+func (view *View) layoutCheckBox(gtx layout.Context, th *material.Theme, value *widget.Bool, label string) layout.Dimensions {
+	box := material.CheckBox(th, value, label)
+	box.TextSize = unit.Sp(CaptionHeight)
+	box.Color = TextColor
+	box.IconColor = TextColor
+	return layout.Inset{Left: unit.Dp(SeriesPadding)}.Layout(gtx, box.Layout)
+}
+
+// displayedProcess returns the ID of the only displayed process, or 0.
+func (view *View) displayedProcess() int {
+	if view.process != 0 {
+		return view.process
+	}
+	if len(view.Summary.Processes) == 1 {
+		return view.Summary.Processes[0].ID
+	}
+	return 0
+}
+
+// layoutStatus displays the grouping and information about the monitored processes.
+func (view *View) layoutStatus(gtx layout.Context, th *material.Theme, shown int) layout.Dimensions {
+	text := "Grouped by " + view.Summary.Config.Group.String() + " (G to switch)"
+	if view.Summary.Config.Group == GroupStack {
+		text += ", depth " + strconv.Itoa(view.Summary.Collection.Depth) + " ([ and ] to change)"
+	}
+	text += ", showing " + view.Summary.Config.Caption.String() + " (F to switch)"
+	text += ", " + view.Summary.Config.Metric.String() + " (M to switch)"
+	text += ", sorted by " + view.Summary.Config.Sort.String() + " (S to switch"
+	if view.frozen != nil {
+		text += ", frozen, O to unfreeze)"
+	} else {
+		text += ", O to freeze)"
+	}
+
+	if len(view.Summary.Processes) > 1 {
+		process := "all " + strconv.Itoa(len(view.Summary.Processes)) + " processes"
+		if view.process != 0 {
+			process = view.Summary.ProcessName(view.process)
+		}
+		text += ", " + process + " (P to switch)"
+	}
+	if process := view.displayedProcess(); process != 0 {
+		text += ", " + strconv.Itoa(int(view.Summary.GCCycles(process))) + " GC cycles"
+	}
+
+	text += ", " + view.timeline.Status(&view.Summary.Collection.Collection)
+
+	if leaks := len(view.Summary.Leaks()); leaks > 0 {
+		text += ", " + strconv.Itoa(leaks) + " leaking"
+	}
+
+	if total := len(view.Summary.Collection.List); shown != total {
+		text += ", " + strconv.Itoa(shown) + " of " + strconv.Itoa(total) + " series"
+	}
+
+	label := material.Label(th, unit.Sp(CaptionHeight), text)
+	label.Color = TextColor
+	return layout.UniformInset(unit.Dp(SeriesPadding)).Layout(gtx, label.Layout)
+}
+
+func (view *View) layoutSeries(gtx layout.Context, th *material.Theme, list []*series.Series) layout.Dimensions {
+	collection := view.Summary.Collection
+	multiprocess := len(view.Summary.Processes) > 1
+	metric := view.Summary.Config.Metric
 
 	inset := layout.Inset{Bottom: unit.Dp(SeriesPadding)}
 
-	view.series.Layout(gtx, len(collection.List), func(gtx layout.Context, i int) layout.Dimensions {
+	return view.series.Layout(gtx, len(list), func(gtx layout.Context, i int) layout.Dimensions {
 		return inset.Layout(gtx, func(gtx layout.Context) (dimension layout.Dimensions) {
 			captionWidth := gtx.Dp(CaptionWidth)
 			seriesHeight := gtx.Dp(SeriesHeight)
-			series := collection.List[i]
+			series := list[i]
 
 			return layout.Flex{}.Layout(gtx,
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					size := image.Pt(captionWidth, seriesHeight)
-					FillRect(gtx.Ops, selectColor(i, RowBackgroundEvenH, RowBackgroundOddH), image.Rectangle{Max: size})
 
-					name := view.Summary.StackAsString(series.Stack)
+					row := view.row(series)
+					for _, ev := range row.click.Events(gtx) {
+						if ev.Type == gesture.TypeClick {
+							if ev.Modifiers.Contain(key.ModShift) {
+								view.togglePin(series)
+							} else if view.selected == series {
+								view.selected = nil
+							} else {
+								view.selected = series
+							}
+						}
+					}
+
+					leak, leaking := view.Summary.Leak(series)
+
+					background := selectColor(i, RowBackgroundEvenH, RowBackgroundOddH)
+					if leaking {
+						background = RowLeaking
+					}
+					if view.pinned[series] {
+						background = RowPinned
+					}
+					if view.selected == series {
+						background = RowSelected
+					}
+					FillRect(gtx.Ops, background, image.Rectangle{Max: size})
+
+					area := clip.Rect(image.Rectangle{Max: size}).Push(gtx.Ops)
+					row.click.Add(gtx.Ops)
+					area.Pop()
+
+					name := view.Summary.SeriesName(series)
+					if multiprocess {
+						name = view.Summary.ProcessName(series.Process) + "\n" + name
+					}
 					// TODO: don't wrap lines
-					live := SizeToString(series.TotalAllocBytes) + " / " + strconv.Itoa(int(series.TotalAllocObjects))
+					live := metric.Caption(series)
+					if view.pinned[series] {
+						live = "pinned, " + live
+					}
+					if leaking {
+						live += ", leaking " + GrowthToString(leak.Growth)
+					}
 					label := material.Label(th, unit.Sp(CaptionHeight-3), name+live)
 					label.Color = TextColor
 
@@ -108,59 +577,91 @@ func (view *View) Update(gtx layout.Context, th *material.Theme) {
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 					areaSize := image.Pt(gtx.Constraints.Max.X, seriesHeight)
 					FillRect(gtx.Ops, selectColor(i, RowBackgroundEven, RowBackgroundOdd), image.Rectangle{Max: areaSize})
+					view.timeline.Input(gtx, image.Rectangle{Max: areaSize})
 
-					samples := areaSize.X / SampleWidth
-					low := collection.SampleHead - samples
-					if low < 0 {
-						low = 0
-					}
-					high := low + samples
+					row := view.row(series)
+					row.UpdateHover(gtx)
+					row.Hover(gtx, image.Rectangle{Max: areaSize})
 
-					max := series.MaxSampleBytes()
+					bars := areaSize.X / SampleWidth
+					hovered := -1
+					if row.hovering {
+						hovered = row.hoverX / SampleWidth
+						if hovered >= bars {
+							hovered = -1
+						}
+					}
+					if hovered >= 0 {
+						FillRect(gtx.Ops, HoverColor, image.Rectangle{
+							Min: image.Pt(hovered*SampleWidth, 0),
+							Max: image.Pt((hovered+1)*SampleWidth, areaSize.Y),
+						})
+					}
 
-					prop := 1.0 / float32(max+1)
-					scale := float32(areaSize.Y/2) / float32(max+1)
+					bins := view.timeline.Bins(&collection.Collection, series, bars)
+					after := view.timeline.After(&collection.Collection, series, bars)
+					values, opposite := metric.Bars(series, bins, after)
 
-					corner := image.Point{
-						Y: areaSize.Y / 2,
+					var max int64
+					for i := range values {
+						max = maxInt64(max, values[i])
+						if opposite != nil {
+							max = maxInt64(max, opposite[i])
+						}
 					}
-					for p := low; p < high; p++ {
-						sample := series.Samples[p%collection.SampleCount]
 
-						if p == collection.SampleHead {
-							headColor := color.NRGBA{0x30, 0x30, 0x30, 0xFF}
-							FillRect(gtx.Ops, headColor, image.Rectangle{
-								Min: image.Point{X: int(corner.X), Y: 0},
-								Max: image.Point{X: int(corner.X + SampleWidth), Y: int(areaSize.Y)},
-							})
-							continue
-						}
+					prop := 1.0 / float32(max+1)
+					height := areaSize.Y
+					if opposite != nil {
+						height = areaSize.Y / 2
+					}
+					scale := float32(height) / float32(max+1)
 
-						if sample.AllocBytes > 0 {
-							c := g.HSL(0, 0.6, g.LerpClamp(float32(sample.AllocBytes)*prop, 0.3, 0.7))
+					// without opposite values the bars grow from the bottom
+					corner := image.Point{Y: areaSize.Y / 2}
+					direction := 1
+					if opposite == nil {
+						corner.Y = areaSize.Y
+						direction = -1
+					}
+					for i, value := range values {
+						if value > 0 {
+							c := g.HSL(0, 0.6, g.LerpClamp(float32(value)*prop, 0.3, 0.7))
 							FillRect(gtx.Ops, c, image.Rectangle{
 								Min: corner,
 								Max: corner.Add(image.Point{
 									X: SampleWidth,
-									Y: int(float32(sample.AllocBytes) * scale),
+									Y: direction * int(float32(value)*scale),
 								}),
-							})
+							}.Canon())
 						}
 
-						if sample.FreeBytes > 0 {
-							c := g.HSL(0.3, 0.6, g.LerpClamp(float32(sample.FreeBytes)*prop, 0.3, 0.7))
+						if opposite != nil && opposite[i] > 0 {
+							c := g.HSL(0.3, 0.6, g.LerpClamp(float32(opposite[i])*prop, 0.3, 0.7))
 							FillRect(gtx.Ops, c, image.Rectangle{
 								Min: corner,
 								Max: corner.Add(image.Point{
 									X: SampleWidth,
-									Y: int(float32(-sample.FreeBytes) * scale),
+									Y: int(float32(-opposite[i]) * scale),
 								}),
-							})
+							}.Canon())
 						}
 
 						corner.X += SampleWidth
 					}
 
+					view.drawGCMarks(gtx, areaSize)
+
+					if hovered >= 0 {
+						from, to := view.timeline.Bar(&collection.Collection, bars, hovered)
+						text := Tooltip(&collection.Collection, from, to, bins[hovered])
+						if opposite == nil {
+							text += "\n" + metric.String() + " " + metric.Format(values[hovered])
+						}
+						text += GCTooltip(view.Summary.GCsBetween(view.process, from, to))
+						layoutTooltip(gtx, th, image.Pt(row.hoverX, 0), areaSize.X, text)
+					}
+
 					return layout.Dimensions{Size: areaSize}
 				}),
 			)
@@ -168,6 +669,204 @@ func (view *View) Update(gtx layout.Context, th *material.Theme) {
 	})
 }
 
+// drawGCMarks draws vertical markers at the bars that contain a GC cycle.
+func (view *View) drawGCMarks(gtx layout.Context, size image.Point) {
+	bars := size.X / SampleWidth
+	if len(view.gcMarks) != bars {
+		coll := &view.Summary.Collection.Collection
+		low, _ := view.timeline.Range(coll, bars)
+
+		view.gcMarks = make([]bool, bars)
+		for _, gc := range view.Summary.GCs {
+			if view.process != 0 && gc.Process != view.process {
+				continue
+			}
+			if gc.Sample < low {
+				continue
+			}
+			if i := (gc.Sample - low) / view.timeline.Zoom; i < bars {
+				view.gcMarks[i] = true
+			}
+		}
+	}
+
+	for i, marked := range view.gcMarks {
+		if marked {
+			x := i*SampleWidth + SampleWidth/2
+			FillRect(gtx.Ops, GCMarkerColor, image.Rect(x, 0, x+1, size.Y))
+		}
+	}
+}
+
+// layoutTooltip draws text next to pos on top of everything else,
+// keeping it inside width when possible.
+func layoutTooltip(gtx layout.Context, th *material.Theme, pos image.Point, width int, text string) {
+	gtx.Constraints = layout.Constraints{Max: image.Pt(width, gtx.Constraints.Max.Y*4)}
+
+	macro := op.Record(gtx.Ops)
+	dims := layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			FillRect(gtx.Ops, TooltipBackground, image.Rectangle{Max: gtx.Constraints.Min})
+			return layout.Dimensions{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				label := material.Label(th, unit.Sp(CaptionHeight-1), text)
+				label.Color = TextColor
+				return label.Layout(gtx)
+			})
+		}),
+	)
+	call := macro.Stop()
+
+	margin := gtx.Dp(8)
+	pos.X += margin
+	if pos.X+dims.Size.X > width {
+		pos.X -= 2*margin + dims.Size.X
+	}
+	if pos.X < 0 {
+		pos.X = 0
+	}
+
+	macro = op.Record(gtx.Ops)
+	offset := op.Offset(pos).Push(gtx.Ops)
+	call.Add(gtx.Ops)
+	offset.Pop()
+	op.Defer(gtx.Ops, macro.Stop())
+}
+
+// layoutRuntime displays the heap size and GC activity of the displayed
+// processes on the same time axis as the series.
+func (view *View) layoutRuntime(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	if len(view.Summary.Processes) == 0 {
+		return layout.Dimensions{}
+	}
+
+	summary := view.Summary
+	coll := &summary.Collection.Collection
+	head := coll.SampleHead
+	process := view.process
+
+	heap := func(t int) float64 { return summary.GaugeOr(process, t, GaugeHeapObjects, GaugeHeapInuse) }
+	goal := func(t int) float64 { return summary.GaugeOr(process, t, GaugeHeapGoal, GaugeNextGC) }
+	cycles := func(t int) float64 { return summary.GaugeOr(process, t, GaugeGCCycles, GaugeNumGC) }
+	pause := func(t int) float64 { return summary.GaugeOr(process, t, GaugePauseTotal) }
+
+	heapCaption := "heap " + SizeToString(int64(heap(head))) + ", goal " + SizeToString(int64(goal(head)))
+	if goroutines, ok := summary.Gauge(process, GaugeGoroutines, head); ok {
+		heapCaption += ", " + strconv.Itoa(int(goroutines)) + " goroutines"
+	}
+	gcCaption := strconv.Itoa(int(cycles(head))) + " GC cycles, " +
+		"pauses " + time.Duration(pause(head)).String() + ", " +
+		strconv.FormatFloat(summary.GaugeOr(process, head, GaugeGCCPUPercent), 'f', 1, 64) + "% GC CPU"
+
+	inset := layout.Inset{Bottom: unit.Dp(SeriesPadding)}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return view.layoutRuntimeRow(gtx, th, &view.runtimeRows[0], heapCaption, func(gtx layout.Context, size image.Point) {
+					bars := size.X / SampleWidth
+					heaps, goals := make([]float64, bars), make([]float64, bars)
+					var max float64
+					for i := range heaps {
+						from, to := view.timeline.Bar(coll, bars, i)
+						if from >= to {
+							continue
+						}
+						heaps[i], goals[i] = heap(to-1), goal(to-1)
+						max = math.Max(max, math.Max(heaps[i], goals[i]))
+					}
+
+					scale := float64(size.Y) / (max + 1)
+					for i := range heaps {
+						x := i * SampleWidth
+						FillRect(gtx.Ops, HeapColor, image.Rect(x, size.Y-int(heaps[i]*scale), x+SampleWidth, size.Y))
+						if goals[i] > 0 {
+							y := size.Y - int(goals[i]*scale)
+							FillRect(gtx.Ops, HeapGoalColor, image.Rect(x, y, x+SampleWidth, y+1))
+						}
+					}
+				})
+			})
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return view.layoutRuntimeRow(gtx, th, &view.runtimeRows[1], gcCaption, func(gtx layout.Context, size image.Point) {
+					bars := size.X / SampleWidth
+					pauses, counts := make([]float64, bars), make([]float64, bars)
+					var max float64
+					for i := range pauses {
+						from, to := view.timeline.Bar(coll, bars, i)
+						if from >= to {
+							continue
+						}
+						pauses[i] = pause(to-1) - pause(from-1)
+						counts[i] = cycles(to-1) - cycles(from-1)
+						max = math.Max(max, pauses[i])
+					}
+
+					scale := float64(size.Y) / (max + 1)
+					for i := range pauses {
+						if counts[i] <= 0 {
+							continue
+						}
+						x := i * SampleWidth
+						// make cycles visible even when the pause is negligible
+						height := int(pauses[i]*scale) + 2
+						FillRect(gtx.Ops, GCPauseColor, image.Rect(x, size.Y-height, x+SampleWidth, size.Y))
+					}
+				})
+			})
+		}),
+	)
+}
+
+// layoutRuntimeRow displays a caption and a chart drawn by draw.
+func (view *View) layoutRuntimeRow(gtx layout.Context, th *material.Theme, row *rowState, caption string, draw func(gtx layout.Context, size image.Point)) layout.Dimensions {
+	captionWidth := gtx.Dp(CaptionWidth)
+	height := gtx.Dp(RuntimeHeight)
+
+	return layout.Flex{}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			size := image.Pt(captionWidth, height)
+			FillRect(gtx.Ops, RowBackgroundOddH, image.Rectangle{Max: size})
+
+			label := material.Label(th, unit.Sp(CaptionHeight-3), caption)
+			label.Color = TextColor
+			gtx.Constraints = layout.Exact(size)
+			_ = label.Layout(gtx)
+
+			return layout.Dimensions{Size: size}
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			size := image.Pt(gtx.Constraints.Max.X, height)
+			FillRect(gtx.Ops, RowBackgroundOdd, image.Rectangle{Max: size})
+			view.timeline.Input(gtx, image.Rectangle{Max: size})
+
+			row.UpdateHover(gtx)
+			row.Hover(gtx, image.Rectangle{Max: size})
+
+			draw(gtx, size)
+			view.drawGCMarks(gtx, size)
+
+			if row.hovering && row.hoverX/SampleWidth < size.X/SampleWidth {
+				coll := &view.Summary.Collection.Collection
+				from, to := view.timeline.Bar(coll, size.X/SampleWidth, row.hoverX/SampleWidth)
+				text := coll.SampleTime(from).Format("15:04:05.000") + GCTooltip(view.Summary.GCsBetween(view.process, from, to))
+				layoutTooltip(gtx, th, image.Pt(row.hoverX, 0), size.X, text)
+			}
+			return layout.Dimensions{Size: size}
+		}),
+	)
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func FillRect(ops *op.Ops, c color.NRGBA, r image.Rectangle) {
 	paint.FillShape(ops, c, clip.Rect(r).Op())
 }
@@ -178,7 +877,18 @@ var (
 	RowBackgroundEvenH = color.NRGBA{0x18, 0x18, 0x18, 0xFF}
 	RowBackgroundOdd   = color.NRGBA{0x22, 0x22, 0x22, 0xFF}
 	RowBackgroundOddH  = color.NRGBA{0x28, 0x28, 0x28, 0xFF}
+	RowSelected        = color.NRGBA{0x20, 0x30, 0x50, 0xFF}
+	RowLeaking         = color.NRGBA{0x48, 0x20, 0x20, 0xFF}
+	RowPinned          = color.NRGBA{0x30, 0x30, 0x20, 0xFF}
+	HoverColor         = color.NRGBA{0x44, 0x44, 0x44, 0xFF}
+	TooltipBackground  = color.NRGBA{0x30, 0x30, 0x38, 0xF0}
+	HeapColor          = color.NRGBA{0x30, 0x60, 0xA0, 0xFF}
+	HeapGoalColor      = color.NRGBA{0xE0, 0xC0, 0x40, 0xFF}
+	GCPauseColor       = color.NRGBA{0xE0, 0x80, 0x30, 0xFF}
+	GCMarkerColor      = color.NRGBA{0x80, 0x80, 0xFF, 0x50}
 	TextColor          = color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	HintColor          = color.NRGBA{0x88, 0x88, 0x88, 0xFF}
+	ErrorColor         = color.NRGBA{0xFF, 0x66, 0x66, 0xFF}
 )
 
 func selectColor(i int, values ...color.NRGBA) color.NRGBA {